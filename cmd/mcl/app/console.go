@@ -0,0 +1,74 @@
+package app
+
+import (
+	"io"
+	"net"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	"github.com/snugfox/mcl/internal/log"
+)
+
+// ConsoleFlags contains the flags for the MCL console command
+type ConsoleFlags struct {
+	WorkingDir    string
+	ConsoleSocket string
+}
+
+// NewConsoleFlags returns a new ConsoleFlags object with default parameters
+func NewConsoleFlags() *ConsoleFlags {
+	return &ConsoleFlags{
+		WorkingDir:    "", // Current directory
+		ConsoleSocket: defaultConsoleSocket,
+	}
+}
+
+// FlagSet returns a new pflag.FlagSet with MCL console command flags
+func (cf *ConsoleFlags) FlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("console", pflag.ExitOnError)
+	fs.StringVar(&cf.WorkingDir, "working-dir", cf.WorkingDir, "Working directory of the running server")
+	fs.StringVar(&cf.ConsoleSocket, "console-socket", cf.ConsoleSocket, "Path of the console socket, relative to the working directory")
+	return fs
+}
+
+// NewConsoleCommand creates a new *cobra.Command for the MCL console command
+// with default flags.
+func NewConsoleCommand() *cobra.Command {
+	consoleFlags := NewConsoleFlags()
+
+	cmd := &cobra.Command{
+		Use:   "console",
+		Short: "Attach to the console of a server started by mcl run",
+		Run: func(cmd *cobra.Command, _ []string) {
+			logger := log.NewLogger(os.Stderr, false)
+			defer logger.Sync()
+
+			socketPath := consoleSocketPath(consoleFlags.WorkingDir, consoleFlags.ConsoleSocket)
+			logger = logger.With(zap.String("consoleSocket", socketPath))
+			conn, err := net.Dial("unix", socketPath)
+			if err != nil {
+				logger.Fatal(
+					"Failed to connect to console socket",
+					zap.Error(err),
+				)
+			}
+			defer conn.Close()
+
+			// Send commands from stdin, closing the connection for writing once
+			// stdin is exhausted, and print server output until the server closes
+			// the connection
+			go func() {
+				io.Copy(conn, os.Stdin)
+				conn.(*net.UnixConn).CloseWrite()
+			}()
+			io.Copy(os.Stdout, conn)
+		},
+	}
+
+	cmd.PersistentFlags().AddFlagSet(consoleFlags.FlagSet())
+
+	return cmd
+}
@@ -1,16 +1,12 @@
 package app
 
 import (
-	"context"
-	"os"
-
-	"github.com/snugfox/mcl/internal/bundle"
-
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 
-	"github.com/snugfox/mcl/internal/log"
+	"github.com/snugfox/mcl/internal/bundle"
+	"github.com/snugfox/mcl/pkg/provider"
 	"github.com/snugfox/mcl/pkg/store"
 )
 
@@ -18,6 +14,7 @@ import (
 type FetchFlags struct {
 	StoreDir       string
 	StoreStructure string
+	SharedBlobs    bool
 	Edition        string
 	Version        string
 }
@@ -27,8 +24,9 @@ func NewFetchFlags() *FetchFlags {
 	return &FetchFlags{
 		StoreDir:       "", // Current directory
 		StoreStructure: defaultStoreStructure,
-		Edition:        "", // Required flag
-		Version:        "", // Required flag
+		SharedBlobs:    false, // Separate copies in each base directory
+		Edition:        "",    // Required flag
+		Version:        "",    // Required flag
 	}
 }
 
@@ -37,6 +35,7 @@ func (ff *FetchFlags) FlagSet() *pflag.FlagSet {
 	fs := pflag.NewFlagSet("fetch", pflag.ExitOnError)
 	fs.StringVar(&ff.StoreDir, "store-dir", ff.StoreDir, "Directory to store server resources")
 	fs.StringVar(&ff.StoreStructure, "store-structure", ff.StoreStructure, "Directory structure for storing server resources")
+	fs.BoolVar(&ff.SharedBlobs, "shared-blobs", ff.SharedBlobs, "Share identical server resources between base directories through a blob store within the store directory")
 	fs.StringVar(&ff.Edition, "edition", ff.Edition, "Minecraft edition identifier")
 	fs.StringVar(&ff.Version, "version", ff.Version, "Version identifier")
 	return fs
@@ -44,21 +43,32 @@ func (ff *FetchFlags) FlagSet() *pflag.FlagSet {
 
 // NewFetchCommand creates a new *cobra.Command for the MCL fetch command with
 // default flags.
-func NewFetchCommand() *cobra.Command {
+func NewFetchCommand(mclFlags *MCLFlags) *cobra.Command {
 	fetchFlags := NewFetchFlags()
 
 	cmd := &cobra.Command{
 		Use:   "fetch",
 		Short: "Fetch resources for a edition and version",
 		Run: func(cmd *cobra.Command, _ []string) {
-			ctx := context.Background()
-			logger := log.NewLogger(os.Stderr, false)
+			logger, progress := newProgressLogger()
 			defer logger.Sync()
+			ctx, err := newContext(mclFlags)
+			if err != nil {
+				logger.Fatal("Failed to configure HTTP client", zap.Error(err))
+			}
 
 			// Resolve edition to its provider
 			edition := fetchFlags.Edition
 			logger = logger.With(zap.String("edition", edition))
-			p, ok := bundle.NewProviderBundle()[edition]
+			providers, err := newProviderBundle(mclFlags, fetchFlags.StoreDir, logger)
+			if err != nil {
+				logger.Fatal(
+					"Failed to load providers",
+					zap.Error(err),
+				)
+			}
+			defer bundle.Close(providers)
+			p, ok := providers[edition]
 			if !ok {
 				logger.Fatal("Provider not found")
 			}
@@ -100,8 +110,20 @@ func NewFetchCommand() *cobra.Command {
 				)
 			}
 
-			// Fetch server resources if needed
-			isFetchNeeded, err := p.IsFetchNeeded(ctx, baseDir, version)
+			// Fetch server resources if needed, reporting progress
+			ctx = provider.WithProgress(ctx, progress)
+			if fetchFlags.SharedBlobs {
+				ctx = provider.WithBlobStore(ctx, store.NewBlobStore(fetchFlags.StoreDir))
+			}
+			lock, err := lockBaseDir(ctx, mclFlags, baseDir, logger)
+			if err != nil {
+				logger.Fatal(
+					"Failed to lock base directory",
+					zap.Error(err),
+				)
+			}
+			defer lock.Unlock()
+			isFetchNeeded, err := p.IsFetchNeeded(ctx, baseDir, resolvedVersion)
 			if err != nil {
 				logger.Warn(
 					"Failed to determine if fetch is needed; fetching anyways",
@@ -110,7 +132,7 @@ func NewFetchCommand() *cobra.Command {
 			}
 			if isFetchNeeded {
 				logger.Info("Fetching resources")
-				if err := p.Fetch(ctx, baseDir, version); err != nil {
+				if err := p.Fetch(ctx, baseDir, resolvedVersion); err != nil {
 					logger.Fatal(
 						"Failed to fetch resources",
 						zap.Error(err),
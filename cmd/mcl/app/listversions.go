@@ -11,53 +11,85 @@ import (
 
 	"github.com/snugfox/mcl/internal/bundle"
 	"github.com/snugfox/mcl/internal/log"
+	"github.com/snugfox/mcl/pkg/provider"
+	"github.com/snugfox/mcl/pkg/store"
 )
 
 // ListVersionsFlags contains the flags for the MCL list-versions command
 type ListVersionsFlags struct {
-	Edition string
-	Offline bool
+	StoreDir       string
+	StoreStructure string
+	Edition        string
 }
 
 // NewListVersionsFlags returns a new ListVersionsFlags object with default
 // parameters
 func NewListVersionsFlags() *ListVersionsFlags {
 	return &ListVersionsFlags{
-		Edition: "",    // Required flag
-		Offline: false, // Query versions available online
+		StoreDir:       "", // Current directory
+		StoreStructure: defaultStoreStructure,
+		Edition:        "", // Required flag
 	}
 }
 
 // FlagSet returns a new pflag.FlagSet with MCL list-versions command flags
 func (lvf *ListVersionsFlags) FlagSet() *pflag.FlagSet {
 	fs := pflag.NewFlagSet("list-versions", pflag.ExitOnError)
+	fs.StringVar(&lvf.StoreDir, "store-dir", lvf.StoreDir, "Directory to store server resources")
+	fs.StringVar(&lvf.StoreStructure, "store-structure", lvf.StoreStructure, "Directory structure for storing server resources")
 	fs.StringVar(&lvf.Edition, "edition", lvf.Edition, "Minecraft edition")
-	fs.BoolVar(&lvf.Offline, "offline", lvf.Offline, "Only list versions currently available offline")
-	fs.MarkHidden("offline") // Not yet implemented
 	return fs
 }
 
 // NewListVersionsCommand creates a new *cobra.Command for the MCL list-versions
 // command with default flags.
-func NewListVersionsCommand() *cobra.Command {
+func NewListVersionsCommand(mclFlags *MCLFlags) *cobra.Command {
 	listVersionsFlags := NewListVersionsFlags()
 
 	cmd := &cobra.Command{
 		Use:   "list-versions",
 		Short: "Lists available versions for a specified edition",
 		Run: func(cmd *cobra.Command, _ []string) {
-			ctx := context.Background()
 			logger := log.NewLogger(os.Stderr, false)
 			defer logger.Sync()
+			ctx, err := newContext(mclFlags)
+			if err != nil {
+				logger.Fatal("Failed to configure HTTP client", zap.Error(err))
+			}
 
 			// Resolve edition to its provider
 			edition := listVersionsFlags.Edition
 			logger = logger.With(zap.String("edition", edition))
-			p, ok := bundle.NewProviderBundle()[edition]
+			providers, err := newProviderBundle(mclFlags, listVersionsFlags.StoreDir, logger)
+			if err != nil {
+				logger.Fatal(
+					"Failed to load providers",
+					zap.Error(err),
+				)
+			}
+			defer bundle.Close(providers)
+			p, ok := providers[edition]
 			if !ok {
 				logger.Fatal("Provider not found")
 			}
 
+			// Only list versions within the store while offline
+			if mclFlags.Offline {
+				versions, err := listOfflineVersions(ctx, p, listVersionsFlags, logger)
+				if err != nil {
+					logger.Fatal(
+						"Failed to find versions in store",
+						zap.String("storeDir", listVersionsFlags.StoreDir),
+						zap.String("storeStructure", listVersionsFlags.StoreStructure),
+						zap.Error(err),
+					)
+				}
+				for i := range versions {
+					fmt.Println(versions[i])
+				}
+				return
+			}
+
 			// Print versions returned form the provider
 			versions, err := p.Versions(ctx)
 			if err != nil {
@@ -79,3 +111,37 @@ func NewListVersionsCommand() *cobra.Command {
 
 	return cmd
 }
+
+// listOfflineVersions returns the versions within the store that are fetched
+// and prepared, and are therefore available without network access. Versions
+// whose requirements cannot be determined are skipped with a warning.
+func listOfflineVersions(ctx context.Context, p provider.Provider, lvf *ListVersionsFlags, logger *zap.Logger) ([]string, error) {
+	edition, _ := p.Edition()
+	versions, err := store.Versions(lvf.StoreDir, lvf.StoreStructure, edition)
+	if err != nil {
+		return nil, err
+	}
+
+	available := make([]string, 0, len(versions))
+	for _, version := range versions {
+		baseDir, err := store.BaseDir(lvf.StoreDir, lvf.StoreStructure, edition, version)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only list versions that require neither fetching nor preparing
+		ar, err := provider.CheckRequirements(ctx, p, baseDir, version)
+		if err != nil {
+			logger.Warn(
+				"Failed to determine if version is available offline; skipping",
+				zap.String("version", version),
+				zap.Error(err),
+			)
+			continue
+		}
+		if !ar.FetchRequired && !ar.PrepareRequired {
+			available = append(available, version)
+		}
+	}
+	return available, nil
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/snugfox/mcl/pkg/provider"
+)
+
+// offlineTestProvider is a provider whose server resources are fetched once a
+// base directory contains server.jar and prepared once it also contains
+// prepared. Requirements cannot be determined for the version "broken".
+type offlineTestProvider struct {
+	provider.Provider // Methods not used while listing offline versions
+}
+
+func (offlineTestProvider) Edition() (string, string) {
+	return "java", "Minecraft: Java Edition"
+}
+
+func (offlineTestProvider) IsFetchNeeded(_ context.Context, baseDir, version string) (bool, error) {
+	if version == "broken" {
+		return false, errors.New("broken")
+	}
+	_, err := os.Stat(filepath.Join(baseDir, "server.jar"))
+	return os.IsNotExist(err), nil
+}
+
+func (offlineTestProvider) IsPrepareNeeded(_ context.Context, baseDir, _ string) (bool, error) {
+	_, err := os.Stat(filepath.Join(baseDir, "prepared"))
+	return os.IsNotExist(err), nil
+}
+
+func TestListOfflineVersions(t *testing.T) {
+	tests := []struct {
+		name      string
+		structure string
+		files     []string // Slash-separated paths relative to the store
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "default structure",
+			structure: defaultStoreStructure,
+			files: []string{
+				"java/1.16.3/server.jar",
+				"java/1.16.4/server.jar", "java/1.16.4/prepared",
+				"java/1.16.5/server.jar", "java/1.16.5/prepared",
+				"java/broken/server.jar", "java/broken/prepared",
+				"java/1.16.6/prepared",
+				"paper/1.16.5/server.jar", "paper/1.16.5/prepared",
+			},
+			want: []string{"1.16.4", "1.16.5"},
+		},
+		{
+			name:      "nested structure",
+			structure: "servers/{{.Edition}}/{{.Version}}/resources",
+			files: []string{
+				"servers/java/1.16.4/resources/server.jar", "servers/java/1.16.4/resources/prepared",
+				"servers/java/1.16.5/server.jar", "servers/java/1.16.5/prepared",
+			},
+			want: []string{"1.16.4"},
+		},
+		{
+			name:      "version within path element",
+			structure: "{{.Edition}}/mc-{{.Version}}-server",
+			files: []string{
+				"java/mc-1.16.4-server/server.jar", "java/mc-1.16.4-server/prepared",
+				"java/mc-1.16.5-client/server.jar", "java/mc-1.16.5-client/prepared",
+				"java/mc-1.16.6-server",
+			},
+			want: []string{"1.16.4"},
+		},
+		{
+			name:      "structure without version",
+			structure: "{{.Edition}}",
+			files:     []string{"java/server.jar", "java/prepared"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storeDir, err := ioutil.TempDir("", "mcl-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.RemoveAll(storeDir) })
+			for _, f := range tt.files {
+				path := filepath.Join(storeDir, filepath.FromSlash(f))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			lvf := NewListVersionsFlags()
+			lvf.StoreDir = storeDir
+			lvf.StoreStructure = tt.structure
+			got, err := listOfflineVersions(context.Background(), offlineTestProvider{}, lvf, zap.NewNop())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listOfflineVersions error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listOfflineVersions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,25 +1,97 @@
 package app
 
 import (
+	"time"
+
 	"github.com/snugfox/mcl/pkg/version"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// MCLFlags contains the global flags for the MCL application
+type MCLFlags struct {
+	DescriptorDir     string
+	PluginDir         string
+	PluginPath        bool
+	CacheDir          string
+	CacheTTL          time.Duration
+	Refresh           bool
+	Offline           bool
+	AcceptedHostnames []string
+	JavaManifestURL   string
+	JavaMirrorURL     string
+	Proxy             string
+	CAFile            string
+	ConnectTimeout    time.Duration
+	HTTPTimeout       time.Duration
+	LockTimeout       time.Duration
+}
+
+// NewMCLFlags returns a new MCLFlags object with default parameters
+func NewMCLFlags() *MCLFlags {
+	return &MCLFlags{
+		DescriptorDir:     defaultDescriptorDir(),
+		PluginDir:         defaultPluginDir(),
+		PluginPath:        false, // Plugin directory only
+		CacheDir:          defaultCacheDir(),
+		CacheTTL:          defaultCacheTTL,
+		Refresh:           false, // Use cached manifests until they expire
+		Offline:           false, // Access the network as needed
+		AcceptedHostnames: nil,   // Provider defaults
+		JavaManifestURL:   "",    // Launcher manifest provided by Mojang
+		JavaMirrorURL:     "",    // No mirror
+		Proxy:             "",    // Proxy from environment
+		CAFile:            "",    // System certificates only
+		ConnectTimeout:    defaultConnectTimeout,
+		HTTPTimeout:       0, // No timeout, as server resources may be large
+		LockTimeout:       defaultLockTimeout,
+	}
+}
+
+// FlagSet returns a new pflag.FlagSet with MCL global flags
+func (mf *MCLFlags) FlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("mcl", pflag.ExitOnError)
+	fs.StringVar(&mf.DescriptorDir, "descriptor-dir", mf.DescriptorDir, "Directory containing custom provider descriptors")
+	fs.StringVar(&mf.PluginDir, "plugin-dir", mf.PluginDir, "Directory containing provider plugins")
+	fs.BoolVar(&mf.PluginPath, "plugin-path", mf.PluginPath, "Also search each directory in PATH for provider plugins, after the plugin directory")
+	fs.StringVar(&mf.CacheDir, "cache-dir", mf.CacheDir, "Directory for cached manifests; empty disables caching")
+	fs.DurationVar(&mf.CacheTTL, "cache-ttl", mf.CacheTTL, "Duration for which cached manifests are used without revalidation")
+	fs.BoolVar(&mf.Refresh, "refresh", mf.Refresh, "Request manifests again regardless of the age of cached manifests, ignoring cache validators")
+	fs.BoolVar(&mf.Offline, "offline", mf.Offline, "Only use cached manifests and stored server resources without network access")
+	fs.StringArrayVar(&mf.AcceptedHostnames, "accepted-hostname", mf.AcceptedHostnames, "Hostname accepted for an edition in the form edition=hostname, replacing its defaults; may be repeated, and \"*\" accepts any hostname")
+	fs.StringVar(&mf.JavaManifestURL, "java-manifest-url", mf.JavaManifestURL, "URL of the launcher manifest for Minecraft: Java Edition, replacing that provided by Mojang")
+	fs.StringVar(&mf.JavaMirrorURL, "java-mirror-url", mf.JavaMirrorURL, "Base URL of a mirror of the manifests and server JARs provided by Mojang, falling back to Mojang if the mirror misses")
+	fs.StringVar(&mf.Proxy, "proxy", mf.Proxy, "URL of the HTTP(S) proxy for requests, overriding the HTTP_PROXY and HTTPS_PROXY environment variables")
+	fs.StringVar(&mf.CAFile, "ca-file", mf.CAFile, "PEM file containing CA certificates to trust in addition to the system certificates")
+	fs.DurationVar(&mf.ConnectTimeout, "connect-timeout", mf.ConnectTimeout, "Timeout for establishing connections; zero disables the timeout")
+	fs.DurationVar(&mf.HTTPTimeout, "http-timeout", mf.HTTPTimeout, "Overall timeout for each request, including reading the response; zero disables the timeout")
+	fs.DurationVar(&mf.LockTimeout, "lock-timeout", mf.LockTimeout, "Timeout for waiting on other processes fetching or preparing the same server resources; zero waits indefinitely")
+	return fs
+}
+
 // NewMCLCommand creates a new *cobra.Command for the MCL application with
 // default subcommands and flags.
 func NewMCLCommand() *cobra.Command {
+	mclFlags := NewMCLFlags()
+
 	cmd := &cobra.Command{
 		Version: version.Version,
 		Use:     "mcl",
 		Short:   "Minecraft launcher for server deployments",
 	}
 
+	cmd.PersistentFlags().AddFlagSet(mclFlags.FlagSet())
+
 	// Subcommands
-	cmd.AddCommand(NewFetchCommand())
-	cmd.AddCommand(NewListVersionsCommand())
-	cmd.AddCommand(NewPrepareCommand())
-	cmd.AddCommand(NewResolveVersionCommand())
-	cmd.AddCommand(NewRunCommand())
+	cmd.AddCommand(NewConsoleCommand())
+	cmd.AddCommand(NewFetchCommand(mclFlags))
+	cmd.AddCommand(NewListVersionsCommand(mclFlags))
+	cmd.AddCommand(NewPrepareCommand(mclFlags))
+	cmd.AddCommand(NewRCONCommand())
+	cmd.AddCommand(NewResolveVersionCommand(mclFlags))
+	cmd.AddCommand(NewRunCommand(mclFlags))
+	cmd.AddCommand(NewSendCommand())
+	cmd.AddCommand(NewStatusCommand())
 	cmd.AddCommand(NewVersionCommand())
 
 	return cmd
@@ -1,15 +1,11 @@
 package app
 
 import (
-	"context"
-	"os"
-
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 
 	"github.com/snugfox/mcl/internal/bundle"
-	"github.com/snugfox/mcl/internal/log"
 	"github.com/snugfox/mcl/pkg/provider"
 	"github.com/snugfox/mcl/pkg/store"
 )
@@ -18,6 +14,7 @@ import (
 type PrepareFlags struct {
 	StoreDir       string
 	StoreStructure string
+	SharedBlobs    bool
 	Edition        string
 	Version        string
 }
@@ -27,8 +24,9 @@ func NewPrepareFlags() *PrepareFlags {
 	return &PrepareFlags{
 		StoreDir:       "", // Current directory
 		StoreStructure: defaultStoreStructure,
-		Edition:        "", // Required flag
-		Version:        "", // Required flag
+		SharedBlobs:    false, // Separate copies in each base directory
+		Edition:        "",    // Required flag
+		Version:        "",    // Required flag
 	}
 }
 
@@ -37,6 +35,7 @@ func (pf *PrepareFlags) FlagSet() *pflag.FlagSet {
 	fs := pflag.NewFlagSet("prepare", pflag.ExitOnError)
 	fs.StringVar(&pf.StoreDir, "store-dir", pf.StoreDir, "Directory to store server resources")
 	fs.StringVar(&pf.StoreStructure, "store-structure", pf.StoreStructure, "Directory structure for storing server resources")
+	fs.BoolVar(&pf.SharedBlobs, "shared-blobs", pf.SharedBlobs, "Share identical server resources between base directories through a blob store within the store directory")
 	fs.StringVar(&pf.Edition, "edition", pf.Edition, "Minecraft edition identifier")
 	fs.StringVar(&pf.Version, "version", pf.Version, "Version identifier")
 	return fs
@@ -44,21 +43,32 @@ func (pf *PrepareFlags) FlagSet() *pflag.FlagSet {
 
 // NewPrepareCommand creates a new *cobra.Command for the MCL prepare command
 // with default flags.
-func NewPrepareCommand() *cobra.Command {
+func NewPrepareCommand(mclFlags *MCLFlags) *cobra.Command {
 	prepareFlags := NewPrepareFlags()
 
 	cmd := &cobra.Command{
 		Use:   "prepare",
 		Short: "Prepares server resources for a specified Minecraft edition and version",
 		Run: func(cmd *cobra.Command, _ []string) {
-			ctx := context.Background()
-			logger := log.NewLogger(os.Stderr, false)
+			logger, progress := newProgressLogger()
 			defer logger.Sync()
+			ctx, err := newContext(mclFlags)
+			if err != nil {
+				logger.Fatal("Failed to configure HTTP client", zap.Error(err))
+			}
 
 			// Resolve edition to its provider
 			edition := prepareFlags.Edition
 			logger = logger.With(zap.String("edition", edition))
-			p, ok := bundle.NewProviderBundle()[edition]
+			providers, err := newProviderBundle(mclFlags, prepareFlags.StoreDir, logger)
+			if err != nil {
+				logger.Fatal(
+					"Failed to load providers",
+					zap.Error(err),
+				)
+			}
+			defer bundle.Close(providers)
+			p, ok := providers[edition]
 			if !ok {
 				logger.Fatal("Provider not found")
 			}
@@ -97,8 +107,20 @@ func NewPrepareCommand() *cobra.Command {
 				)
 			}
 
-			// Fetch and/or preapre server resoruces as needed
-			actionReqs, err := provider.CheckRequirements(ctx, p, baseDir, version)
+			// Fetch and/or preapre server resoruces as needed, reporting progress
+			ctx = provider.WithProgress(ctx, progress)
+			if prepareFlags.SharedBlobs {
+				ctx = provider.WithBlobStore(ctx, store.NewBlobStore(prepareFlags.StoreDir))
+			}
+			lock, err := lockBaseDir(ctx, mclFlags, baseDir, logger)
+			if err != nil {
+				logger.Fatal(
+					"Failed to lock base directory",
+					zap.Error(err),
+				)
+			}
+			defer lock.Unlock()
+			actionReqs, err := provider.CheckRequirements(ctx, p, baseDir, resolvedVersion)
 			if err != nil {
 				logger.Fatal(
 					"Failed to determine fetch and prepare requirements",
@@ -107,7 +129,7 @@ func NewPrepareCommand() *cobra.Command {
 			}
 			switch {
 			case actionReqs.FetchRequired:
-				if err := p.Fetch(ctx, baseDir, version); err != nil {
+				if err := p.Fetch(ctx, baseDir, resolvedVersion); err != nil {
 					logger.Fatal(
 						"Failure while fetching resources",
 						zap.Error(err),
@@ -116,7 +138,7 @@ func NewPrepareCommand() *cobra.Command {
 				logger.Info("Fetched server resources")
 				fallthrough
 			case actionReqs.PrepareRequired:
-				if err := p.Prepare(ctx, baseDir, version); err != nil {
+				if err := p.Prepare(ctx, baseDir, resolvedVersion); err != nil {
 					logger.Fatal(
 						"Failure while preparing resources",
 						zap.Error(err),
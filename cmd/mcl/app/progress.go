@@ -0,0 +1,167 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/snugfox/mcl/internal/log"
+	"github.com/snugfox/mcl/pkg/provider"
+)
+
+const (
+	// Width of the progress bar in characters
+	progressBarWidth int = 30
+
+	// Interval between progress log entries when not on a terminal
+	progressLogInterval time.Duration = 5 * time.Second
+)
+
+// newProgressLogger returns a new logger writing to stderr and a progress
+// observer that renders progress as a progress bar if stderr is a terminal, or
+// otherwise periodically logs progress to the logger. Entries logged while a
+// progress bar is drawn are written above it.
+func newProgressLogger() (*zap.Logger, provider.ProgressObserver) {
+	if isTerminal(os.Stderr) {
+		pb := &progressBar{w: os.Stderr}
+		return log.NewLogger(zapcore.AddSync(pb), false), pb
+	}
+	logger := log.NewLogger(os.Stderr, false)
+	return logger, &progressLogger{
+		logger: logger,
+		last:   make(map[string]time.Time),
+	}
+}
+
+// isTerminal returns whether a file is a terminal (i.e. character device).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar renders progress as a single line progress bar, which is
+// redrawn in place on each update. Writes to a progressBar are written above
+// the progress bar.
+type progressBar struct {
+	w io.Writer
+
+	mu   sync.Mutex // Guards fields below
+	line string     // Line of the progress bar currently drawn, if any
+}
+
+func (pb *progressBar) ObserveProgress(p provider.Progress) {
+	var sb strings.Builder
+	sb.WriteString(p.Name)
+	if p.BytesTotal > 0 {
+		frac := float64(p.BytesDone) / float64(p.BytesTotal)
+		if frac > 1 {
+			frac = 1
+		}
+		filled := int(frac * float64(progressBarWidth))
+		sb.WriteString(" [")
+		sb.WriteString(strings.Repeat("=", filled))
+		if filled < progressBarWidth {
+			sb.WriteByte('>')
+			sb.WriteString(strings.Repeat(" ", progressBarWidth-filled-1))
+		}
+		fmt.Fprintf(&sb, "] %3.0f%% %s/%s", frac*100, formatBytes(p.BytesDone), formatBytes(p.BytesTotal))
+	} else {
+		fmt.Fprintf(&sb, " %s", formatBytes(p.BytesDone))
+	}
+	fmt.Fprintf(&sb, " %s/s", formatBytes(int64(p.Rate)))
+	if p.ETA >= 0 && !p.Complete {
+		fmt.Fprintf(&sb, " ETA %s", p.ETA.Round(time.Second))
+	}
+	if p.Err != nil {
+		sb.WriteString(" failed")
+	}
+	line := sb.String()
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	padding := ""
+	if len(line) < len(pb.line) { // Clear the remainder of the previous line
+		padding = strings.Repeat(" ", len(pb.line)-len(line))
+	}
+	fmt.Fprint(pb.w, "\r"+line+padding)
+	pb.line = line
+	if p.Complete { // End the line whether the operation succeeded or failed
+		fmt.Fprintln(pb.w)
+		pb.line = ""
+	}
+}
+
+func (pb *progressBar) Write(b []byte) (int, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.line != "" { // Clear the progress bar, and redraw it after b
+		fmt.Fprint(pb.w, "\r"+strings.Repeat(" ", len(pb.line))+"\r")
+		defer fmt.Fprint(pb.w, pb.line)
+	}
+	return pb.w.Write(b)
+}
+
+// progressLogger periodically logs progress to a logger.
+type progressLogger struct {
+	logger *zap.Logger
+
+	mu   sync.Mutex           // Guards fields below
+	last map[string]time.Time // Maps operation name to its last log time
+}
+
+func (pl *progressLogger) ObserveProgress(p provider.Progress) {
+	pl.mu.Lock()
+	now := time.Now()
+	last, ok := pl.last[p.Name]
+	if !ok {
+		pl.last[p.Name] = now // Start the interval from the first update
+	}
+	if !p.Complete && (!ok || now.Sub(last) < progressLogInterval) {
+		pl.mu.Unlock()
+		return
+	}
+	if p.Complete {
+		delete(pl.last, p.Name)
+	} else {
+		pl.last[p.Name] = now
+	}
+	pl.mu.Unlock()
+
+	fields := []zap.Field{
+		zap.String("name", p.Name),
+		zap.Int64("bytesDone", p.BytesDone),
+		zap.Int64("bytesTotal", p.BytesTotal),
+		zap.Float64("bytesPerSecond", p.Rate),
+	}
+	if p.ETA >= 0 && !p.Complete {
+		fields = append(fields, zap.Duration("eta", p.ETA))
+	}
+	switch {
+	case p.Err != nil:
+		pl.logger.Warn("Failed", append(fields, zap.Error(p.Err))...)
+	case p.Complete:
+		pl.logger.Info("Completed", fields...)
+	default:
+		pl.logger.Info("Progress", fields...)
+	}
+}
+
+// formatBytes formats a number of bytes using binary prefixes (e.g. 1.5 MiB).
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
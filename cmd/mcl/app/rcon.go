@@ -0,0 +1,174 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	"github.com/snugfox/mcl/internal/chat"
+	"github.com/snugfox/mcl/internal/log"
+	"github.com/snugfox/mcl/internal/properties"
+	"github.com/snugfox/mcl/pkg/rcon"
+)
+
+// RCONFlags contains the flags for the MCL rcon command
+type RCONFlags struct {
+	WorkingDir string
+	Address    string
+	Password   string
+	Timeout    time.Duration
+}
+
+// NewRCONFlags returns a new RCONFlags object with default parameters
+func NewRCONFlags() *RCONFlags {
+	return &RCONFlags{
+		WorkingDir: "", // Current directory
+		Address:    "", // From server.properties
+		Password:   "", // From server.properties
+		Timeout:    10 * time.Second,
+	}
+}
+
+// FlagSet returns a new pflag.FlagSet with MCL rcon command flags
+func (rf *RCONFlags) FlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("rcon", pflag.ExitOnError)
+	fs.StringVar(&rf.WorkingDir, "working-dir", rf.WorkingDir, "Working directory of the server, from whose server.properties the RCON port and password are read if not specified")
+	fs.StringVar(&rf.Address, "address", rf.Address, "Address of the RCON server as host or host:port")
+	fs.StringVar(&rf.Password, "password", rf.Password, "RCON password")
+	fs.DurationVar(&rf.Timeout, "timeout", rf.Timeout, "Timeout for connecting and for each command")
+	return fs
+}
+
+// NewRCONCommand creates a new *cobra.Command for the MCL rcon command with
+// default flags.
+func NewRCONCommand() *cobra.Command {
+	rconFlags := NewRCONFlags()
+
+	cmd := &cobra.Command{
+		Use:   "rcon [command...]",
+		Short: "Execute commands on a server through RCON, interactively if no command is specified",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := log.NewLogger(os.Stderr, false)
+			defer logger.Sync()
+
+			address, password, err := rconFlags.resolve()
+			if err != nil {
+				logger.Fatal(
+					"Failed to read server properties",
+					zap.Error(err),
+				)
+			}
+			logger = logger.With(zap.String("address", address))
+			client, err := rcon.Dial(address, password, rconFlags.Timeout)
+			if err != nil {
+				logger.Fatal(
+					"Failed to connect to RCON server",
+					zap.Error(err),
+				)
+			}
+			defer client.Close()
+
+			// Execute the command from the arguments, if any
+			if len(args) > 0 {
+				command := strings.Join(args, " ")
+				response, err := client.Command(command)
+				if err != nil {
+					logger.Fatal(
+						"Failed to execute command",
+						zap.String("command", command),
+						zap.Error(err),
+					)
+				}
+				printResponse(response)
+				return
+			}
+
+			// Otherwise, execute commands read from stdin
+			interactive := isTerminal(os.Stdin)
+			s := bufio.NewScanner(os.Stdin)
+			for {
+				if interactive {
+					fmt.Fprint(os.Stderr, "> ")
+				}
+				if !s.Scan() {
+					break
+				}
+				command := strings.TrimSpace(s.Text())
+				if command == "" {
+					continue
+				}
+				response, err := client.Command(command)
+				if err != nil {
+					logger.Fatal(
+						"Failed to execute command",
+						zap.String("command", command),
+						zap.Error(err),
+					)
+				}
+				printResponse(response)
+			}
+		},
+	}
+
+	cmd.PersistentFlags().AddFlagSet(rconFlags.FlagSet())
+
+	return cmd
+}
+
+// resolve returns the address and password of the RCON server, reading those
+// not specified by flags from server.properties in the working directory.
+func (rf *RCONFlags) resolve() (address, password string, err error) {
+	address, password = rf.Address, rf.Password
+	host, port := address, ""
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		host, port = h, p
+	}
+	if port != "" && password != "" {
+		return address, password, nil
+	}
+
+	props, err := properties.Load(filepath.Join(rf.WorkingDir, "server.properties"))
+	if os.IsNotExist(err) {
+		props = make(map[string]string)
+	} else if err != nil {
+		return "", "", err
+	}
+	if host == "" {
+		host = props["server-ip"]
+		if host == "" {
+			host = "localhost"
+		}
+	}
+	if port == "" {
+		port = props["rcon.port"]
+		if port == "" {
+			port = strconv.Itoa(rcon.DefaultPort)
+		}
+	}
+	if password == "" {
+		password = props["rcon.password"]
+	}
+	return net.JoinHostPort(host, port), password, nil
+}
+
+// printResponse prints a command response without formatting codes, ensuring
+// that it ends with a newline.
+func printResponse(response string) {
+	response = chat.StripFormatting(response)
+	if response == "" {
+		return
+	}
+	if !strings.HasSuffix(response, "\n") {
+		response += "\n"
+	}
+	fmt.Print(response)
+}
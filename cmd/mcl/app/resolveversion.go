@@ -1,7 +1,6 @@
 package app
 
 import (
-	"context"
 	"fmt"
 	"os"
 
@@ -38,21 +37,32 @@ func (rvf *ResolveVersionFlags) FlagSet() *pflag.FlagSet {
 
 // NewResolveVersionCommand creates a new *cobra.Command for the MCL
 // resolve-version command with default flags.
-func NewResolveVersionCommand() *cobra.Command {
+func NewResolveVersionCommand(mclFlags *MCLFlags) *cobra.Command {
 	resolveVersionFlags := NewResolveVersionFlags()
 
 	cmd := &cobra.Command{
 		Use:   "resolve-version",
 		Short: "Resolve an alias to its version",
 		Run: func(cmd *cobra.Command, _ []string) {
-			ctx := context.Background()
 			logger := log.NewLogger(os.Stderr, false)
 			defer logger.Sync()
+			ctx, err := newContext(mclFlags)
+			if err != nil {
+				logger.Fatal("Failed to configure HTTP client", zap.Error(err))
+			}
 
 			// Resolve edition to its provider
 			edition := resolveVersionFlags.Edition
 			logger = logger.With(zap.String("edition", edition))
-			p, ok := bundle.NewProviderBundle()[edition]
+			providers, err := newProviderBundle(mclFlags, "", logger)
+			if err != nil {
+				logger.Fatal(
+					"Failed to load providers",
+					zap.Error(err),
+				)
+			}
+			defer bundle.Close(providers)
+			p, ok := providers[edition]
 			if !ok {
 				logger.Fatal("Provider not found")
 			}
@@ -2,14 +2,18 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 
 	"github.com/snugfox/mcl/internal/bundle"
-	"github.com/snugfox/mcl/internal/log"
+	"github.com/snugfox/mcl/pkg/console"
 	"github.com/snugfox/mcl/pkg/provider"
 	"github.com/snugfox/mcl/pkg/store"
 )
@@ -18,11 +22,14 @@ import (
 type RunFlags struct {
 	StoreDir       string
 	StoreStructure string
+	SharedBlobs    bool
 	WorkingDir     string
 	Edition        string
 	Version        string
 	RuntimeArgs    []string
 	ServerArgs     []string
+	StopTimeout    time.Duration
+	ConsoleSocket  string
 }
 
 // NewRunFlags returns a new RunFlags object with default parameters
@@ -30,11 +37,14 @@ func NewRunFlags() *RunFlags {
 	return &RunFlags{
 		StoreDir:       "", // Current directory
 		StoreStructure: defaultStoreStructure,
+		SharedBlobs:    false,      // Separate copies in each base directory
 		WorkingDir:     "",         // Current directory
 		Edition:        "",         // Required flag
 		Version:        "",         // Use edition's default version
 		RuntimeArgs:    []string{}, // No arguments
 		ServerArgs:     []string{}, // No arguments
+		StopTimeout:    provider.DefaultStopTimeout,
+		ConsoleSocket:  defaultConsoleSocket,
 	}
 }
 
@@ -43,115 +53,47 @@ func (rf *RunFlags) FlagSet() *pflag.FlagSet {
 	fs := pflag.NewFlagSet("run", pflag.ExitOnError)
 	fs.StringVar(&rf.StoreDir, "store-dir", rf.StoreDir, "Directory to store server resources")
 	fs.StringVar(&rf.StoreStructure, "store-structure", rf.StoreStructure, "Directory structure for storing server resources")
+	fs.BoolVar(&rf.SharedBlobs, "shared-blobs", rf.SharedBlobs, "Share identical server resources between base directories through a blob store within the store directory")
 	fs.StringVar(&rf.WorkingDir, "working-dir", rf.WorkingDir, "Working directory to run the server from")
 	fs.StringVar(&rf.Edition, "edition", rf.Edition, "Minecraft edition identifier")
 	fs.StringVar(&rf.Version, "version", rf.Version, "Version identifier")
 	fs.StringSliceVar(&rf.RuntimeArgs, "runtime-args", rf.RuntimeArgs, "Arguments to pass to the runtime environment if applicable (e.g. JVM options)")
 	fs.StringSliceVar(&rf.ServerArgs, "server-args", rf.ServerArgs, "Arguments to pass to the server application")
+	fs.StringVar(&rf.ConsoleSocket, "console-socket", rf.ConsoleSocket, "Path of the console socket for mcl console and mcl send, relative to the working directory; empty disables the socket")
+	fs.DurationVar(&rf.StopTimeout, "stop-timeout", rf.StopTimeout, "Duration to wait for the server to stop gracefully on SIGINT or SIGTERM before killing it; must be positive, and a second signal kills it immediately")
 	return fs
 }
 
 // NewRunCommand creates a new *cobra.Command for the MCL run command with
 // default flags.
-func NewRunCommand() *cobra.Command {
+func NewRunCommand(mclFlags *MCLFlags) *cobra.Command {
 	runFlags := NewRunFlags()
 
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Run a specified Minecraft edition server",
 		Run: func(cmd *cobra.Command, _ []string) {
-			ctx := context.Background()
-			logger := log.NewLogger(os.Stderr, false)
+			logger, progress := newProgressLogger()
 			defer logger.Sync()
-
-			// Resolve edition to its provider
-			edition := runFlags.Edition
-			logger = logger.With(zap.String("edition", edition))
-			p, ok := bundle.NewProviderBundle()[edition]
-			if !ok {
-				logger.Fatal("Provider not found")
-			}
-
-			// Resolve version either from the provider (if not specified) or from the
-			// flag.
-			// TODO: De-dupe logger.With calls in if-else blocks
-			var version string
-			if runFlags.Version == "" {
-				version = p.DefaultVersion()
-				logger = logger.With(zap.String("version", version))
-				logger.Info("Using default version")
-			} else {
-				version = runFlags.Version
-				logger = logger.With(zap.String("version", version))
-			}
-
-			resolvedVersion, err := p.ResolveVersion(ctx, version)
-			if err != nil {
-				logger.Fatal(
-					"Failed to resolve version",
-					zap.Error(err),
-				)
+			if runFlags.StopTimeout <= 0 {
+				logger.Fatal("Stop timeout must be positive", zap.Duration("stopTimeout", runFlags.StopTimeout))
 			}
-			logger = logger.With(zap.String("resolvedVersion", resolvedVersion))
-			logger.Info("Resolved version")
-
-			// Form the base directory for the given store directory, structure,
-			// edition, and version.
-			baseDir, err := store.BaseDir(runFlags.StoreDir, runFlags.StoreStructure, edition, resolvedVersion)
+			ctx, err := newContext(mclFlags)
 			if err != nil {
-				logger.Fatal(
-					"Failed to execute directory template",
-					zap.String("directoryTemplate", runFlags.StoreDir),
-					zap.Error(err),
-				)
+				logger.Fatal("Failed to configure HTTP client", zap.Error(err))
 			}
 
-			// Fetch and/or preapre server resoruces as needed
-			actionReqs, err := provider.CheckRequirements(ctx, p, baseDir, version)
-			if err != nil {
-				logger.Fatal(
-					"Failed to determine fetch and prepare requirements",
-					zap.Error(err),
-				)
-			}
-			switch {
-			case actionReqs.FetchRequired:
-				if err := p.Fetch(ctx, baseDir, version); err != nil {
-					logger.Fatal(
-						"Failure while fetching resources",
-						zap.Error(err),
-					)
-				}
-				logger.Info("Fetched server resources")
-				fallthrough
-			case actionReqs.PrepareRequired:
-				if err := p.Prepare(ctx, baseDir, version); err != nil {
-					logger.Fatal(
-						"Failure while preparing resources",
-						zap.Error(err),
-					)
-				}
-				logger.Info("Prepared server resources")
-			}
+			logger = logger.With(zap.String("edition", runFlags.Edition))
 
-			// Run server according to the provider
-			workingDir := runFlags.WorkingDir
-			runtimeArgs := runFlags.RuntimeArgs
-			serverArgs := runFlags.ServerArgs
-			logger = logger.With(
-				zap.String("workingDir", workingDir),
-				zap.Strings("runtimeArgs", runtimeArgs),
-				zap.Strings("serverArgs", serverArgs),
-			)
-			logger.Info("Running server")
-			if err := p.Run(ctx, baseDir, workingDir, version, runtimeArgs, serverArgs); err != nil {
+			// Resources held while running (e.g. plugins, the base directory lock,
+			// and the console socket) are released before exiting on failure
+			if err := runServer(ctx, mclFlags, runFlags, logger, progress); err != nil {
 				logger.Fatal(
-					"Failure while running server",
+					"Failed to run server",
 					zap.Error(err),
 				)
-			} else {
-				logger.Info("Server exited successfully")
 			}
+			logger.Info("Server exited successfully")
 		},
 	}
 
@@ -164,3 +106,161 @@ func NewRunCommand() *cobra.Command {
 
 	return cmd
 }
+
+// runServer runs the server for the edition and version of the run flags,
+// fetching and preparing its resources as needed. Errors are returned once any
+// resources held have been released.
+func runServer(ctx context.Context, mf *MCLFlags, rf *RunFlags, logger *zap.Logger, progress provider.ProgressObserver) error {
+	// Resolve edition to its provider
+	edition := rf.Edition
+	providers, err := newProviderBundle(mf, rf.StoreDir, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load providers: %w", err)
+	}
+	defer bundle.Close(providers)
+	p, ok := providers[edition]
+	if !ok {
+		return fmt.Errorf("provider not found for edition %s", edition)
+	}
+
+	// Resolve version either from the provider (if not specified) or from the
+	// flag.
+	// TODO: De-dupe logger.With calls in if-else blocks
+	var version string
+	if rf.Version == "" {
+		version = p.DefaultVersion()
+		logger = logger.With(zap.String("version", version))
+		logger.Info("Using default version")
+	} else {
+		version = rf.Version
+		logger = logger.With(zap.String("version", version))
+	}
+
+	resolvedVersion, err := p.ResolveVersion(ctx, version)
+	if err != nil {
+		return fmt.Errorf("failed to resolve version %s: %w", version, err)
+	}
+	logger = logger.With(zap.String("resolvedVersion", resolvedVersion))
+	logger.Info("Resolved version")
+
+	// Form the base directory for the given store directory, structure,
+	// edition, and version.
+	baseDir, err := store.BaseDir(rf.StoreDir, rf.StoreStructure, edition, resolvedVersion)
+	if err != nil {
+		return fmt.Errorf("failed to execute directory template %s: %w", rf.StoreStructure, err)
+	}
+
+	// Fetch and/or preapre server resoruces as needed, reporting progress
+	ctx = provider.WithProgress(ctx, progress)
+	if rf.SharedBlobs {
+		ctx = provider.WithBlobStore(ctx, store.NewBlobStore(rf.StoreDir))
+	}
+	if err := ensureResources(ctx, mf, p, baseDir, resolvedVersion, logger); err != nil {
+		return err
+	}
+
+	// Run server according to the provider
+	workingDir := rf.WorkingDir
+	runtimeArgs := rf.RuntimeArgs
+	serverArgs := rf.ServerArgs
+	logger = logger.With(
+		zap.String("workingDir", workingDir),
+		zap.Strings("runtimeArgs", runtimeArgs),
+		zap.Strings("serverArgs", serverArgs),
+	)
+
+	// Multiplex the server console between the terminal and the console
+	// socket, if any
+	con := console.New()
+	defer con.Close()
+	if rf.ConsoleSocket != "" {
+		socketPath := consoleSocketPath(workingDir, rf.ConsoleSocket)
+		if err := con.Listen(socketPath); err != nil {
+			logger.Warn(
+				"Failed to create console socket; continuing without it",
+				zap.String("consoleSocket", socketPath),
+				zap.Error(err),
+			)
+		} else {
+			logger.Info("Listening on console socket", zap.String("consoleSocket", socketPath))
+		}
+	}
+	go con.SendLines(os.Stdin)
+
+	// Stop the server gracefully on SIGINT or SIGTERM (e.g. docker stop),
+	// and kill it on a second signal
+	kill := make(chan struct{})
+	ctx = provider.WithRunOptions(ctx, provider.RunOptions{
+		StopTimeout: rf.StopTimeout,
+		Kill:        kill,
+		Send:        con.Send,
+		Stdin:       con.Input(),
+		Stdout:      con.Output(os.Stdout),
+		Stderr:      con.Output(os.Stderr),
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	runDone := make(chan struct{})
+	defer close(runDone)
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Info(
+				"Stopping server",
+				zap.Stringer("signal", sig),
+				zap.Duration("stopTimeout", rf.StopTimeout),
+			)
+			cancel()
+		case <-runDone:
+			return
+		}
+		select {
+		case sig := <-signals:
+			logger.Info("Killing server", zap.Stringer("signal", sig))
+			close(kill)
+		case <-runDone:
+		}
+	}()
+
+	logger.Info("Running server")
+	return p.Run(ctx, baseDir, workingDir, resolvedVersion, runtimeArgs, serverArgs)
+}
+
+// ensureResources fetches and/or prepares the server resources of a base
+// directory as needed, holding the lock on the base directory meanwhile.
+func ensureResources(ctx context.Context, mf *MCLFlags, p provider.Provider, baseDir, version string, logger *zap.Logger) error {
+	lock, err := lockBaseDir(ctx, mf, baseDir, logger)
+	if err != nil {
+		return fmt.Errorf("failed to lock base directory: %w", err)
+	}
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			logger.Warn(
+				"Failed to unlock base directory",
+				zap.Error(err),
+			)
+		}
+	}()
+
+	actionReqs, err := provider.CheckRequirements(ctx, p, baseDir, version)
+	if err != nil {
+		return fmt.Errorf("failed to determine fetch and prepare requirements: %w", err)
+	}
+	switch {
+	case actionReqs.FetchRequired:
+		if err := p.Fetch(ctx, baseDir, version); err != nil {
+			return fmt.Errorf("failed to fetch resources: %w", err)
+		}
+		logger.Info("Fetched server resources")
+		fallthrough
+	case actionReqs.PrepareRequired:
+		if err := p.Prepare(ctx, baseDir, version); err != nil {
+			return fmt.Errorf("failed to prepare resources: %w", err)
+		}
+		logger.Info("Prepared server resources")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	"github.com/snugfox/mcl/internal/log"
+)
+
+// SendFlags contains the flags for the MCL send command
+type SendFlags struct {
+	WorkingDir    string
+	ConsoleSocket string
+	Wait          time.Duration
+}
+
+// NewSendFlags returns a new SendFlags object with default parameters
+func NewSendFlags() *SendFlags {
+	return &SendFlags{
+		WorkingDir:    "", // Current directory
+		ConsoleSocket: defaultConsoleSocket,
+		Wait:          time.Second,
+	}
+}
+
+// FlagSet returns a new pflag.FlagSet with MCL send command flags
+func (sf *SendFlags) FlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("send", pflag.ExitOnError)
+	fs.StringVar(&sf.WorkingDir, "working-dir", sf.WorkingDir, "Working directory of the running server")
+	fs.StringVar(&sf.ConsoleSocket, "console-socket", sf.ConsoleSocket, "Path of the console socket, relative to the working directory")
+	fs.DurationVar(&sf.Wait, "wait", sf.Wait, "Duration to print server output for after sending the command")
+	return fs
+}
+
+// NewSendCommand creates a new *cobra.Command for the MCL send command with
+// default flags.
+func NewSendCommand() *cobra.Command {
+	sendFlags := NewSendFlags()
+
+	cmd := &cobra.Command{
+		Use:   "send <command...>",
+		Short: "Send a command to the console of a server started by mcl run",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := log.NewLogger(os.Stderr, false)
+			defer logger.Sync()
+
+			socketPath := consoleSocketPath(sendFlags.WorkingDir, sendFlags.ConsoleSocket)
+			logger = logger.With(zap.String("consoleSocket", socketPath))
+			conn, err := net.Dial("unix", socketPath)
+			if err != nil {
+				logger.Fatal(
+					"Failed to connect to console socket",
+					zap.Error(err),
+				)
+			}
+			defer conn.Close()
+
+			command := strings.Join(args, " ")
+			if _, err := io.WriteString(conn, command+"\n"); err != nil {
+				logger.Fatal(
+					"Failed to send command",
+					zap.String("command", command),
+					zap.Error(err),
+				)
+			}
+
+			// Print the server output that follows the command, which is likely to
+			// include its response
+			conn.SetReadDeadline(time.Now().Add(sendFlags.Wait))
+			io.Copy(os.Stdout, conn)
+		},
+	}
+
+	cmd.PersistentFlags().AddFlagSet(sendFlags.FlagSet())
+
+	return cmd
+}
@@ -1,6 +1,209 @@
 package app
 
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/snugfox/mcl/internal/bundle"
+	"github.com/snugfox/mcl/pkg/provider"
+	"github.com/snugfox/mcl/pkg/store"
+)
+
 const (
 	// Subdirectories for edition and version within current directory
 	defaultStoreStructure string = "{{.Edition}}/{{.Version}}/"
+
+	// Duration for which cached manifests are used without revalidation
+	defaultCacheTTL time.Duration = time.Hour
+
+	// Timeout for establishing connections, including TLS handshakes
+	defaultConnectTimeout time.Duration = 30 * time.Second
+
+	// Timeout for waiting on other processes to release a base directory,
+	// which allows for lengthy preparation (e.g. compiling with BuildTools)
+	defaultLockTimeout time.Duration = 30 * time.Minute
+
+	// Path of the console socket relative to the working directory
+	defaultConsoleSocket string = ".mcl-console.sock"
 )
+
+// defaultDescriptorDir returns the default directory for custom provider
+// descriptors within the user's configuration directory, or an empty string if
+// there is no such directory.
+func defaultDescriptorDir() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "mcl", "providers")
+}
+
+// defaultPluginDir returns the default directory for provider plugins within
+// the user's configuration directory, or an empty string if there is no such
+// directory.
+func defaultPluginDir() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "mcl", "plugins")
+}
+
+// defaultCacheDir returns the default MCL cache directory within the user's
+// cache directory, or an empty string if there is no such directory.
+func defaultCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "mcl")
+}
+
+// newContext returns a new context for provider operations according to the
+// MCL global flags.
+func newContext(mf *MCLFlags) (context.Context, error) {
+	client, err := newHTTPClient(mf)
+	if err != nil {
+		return nil, err
+	}
+	ctx := provider.WithHTTPClient(context.Background(), client)
+	if mf.Offline {
+		ctx = provider.WithOffline(ctx)
+	}
+	return ctx, nil
+}
+
+// newHTTPClient returns a new HTTP client for provider requests according to
+// the MCL global flags. Requests are sent through the proxy flag if set, or
+// otherwise the proxy specified by the environment (e.g. HTTPS_PROXY). The
+// certificates in the CA file, if any, are trusted in addition to the system
+// certificate pool.
+func newHTTPClient(mf *MCLFlags) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   mf.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = mf.ConnectTimeout
+
+	if mf.Proxy != "" {
+		proxyURL, err := url.Parse(mf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if mf.CAFile != "" {
+		pem, err := ioutil.ReadFile(mf.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		// The system certificate pool is unavailable on some platforms (e.g.
+		// Windows), in which case only the CA file is trusted.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA file " + mf.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   mf.HTTPTimeout,
+	}, nil
+}
+
+// parseAcceptedHostnames parses accepted hostnames of the form edition=hostname
+// into a map mapping edition ID to its accepted hostnames.
+func parseAcceptedHostnames(acceptedHostnames []string) (map[string][]string, error) {
+	hostnames := make(map[string][]string)
+	for _, s := range acceptedHostnames {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 || i == len(s)-1 {
+			return nil, errors.New("accepted hostname " + s + " is not of the form edition=hostname")
+		}
+		hostnames[s[:i]] = append(hostnames[s[:i]], s[i+1:])
+	}
+	return hostnames, nil
+}
+
+// consoleSocketPath returns the path of a console socket, which is relative to
+// the working directory unless absolute.
+func consoleSocketPath(workingDir, socket string) string {
+	if filepath.IsAbs(socket) {
+		return socket
+	}
+	return filepath.Join(workingDir, socket)
+}
+
+// lockBaseDir acquires the lock on a base directory for fetching and preparing
+// server resources according to the MCL global flags, logging while waiting on
+// another process to release it.
+func lockBaseDir(ctx context.Context, mf *MCLFlags, baseDir string, logger *zap.Logger) (*store.Lock, error) {
+	waited := false
+	lock, err := store.LockBaseDir(ctx, baseDir, mf.LockTimeout, func() {
+		waited = true
+		logger.Info(
+			"Waiting for another process to release the base directory",
+			zap.String("baseDir", baseDir),
+			zap.Duration("lockTimeout", mf.LockTimeout),
+		)
+	})
+	if err == nil && waited {
+		logger.Info("Acquired base directory", zap.String("baseDir", baseDir))
+	}
+	return lock, err
+}
+
+// newProviderBundle creates a new provider bundle according to the MCL global
+// flags for a store directory, within which BuildTools caches its work between
+// builds. Plugins are discovered in the plugin directory, followed by each
+// directory in PATH if enabled. The bundle must be closed with bundle.Close.
+func newProviderBundle(mf *MCLFlags, storeDir string, logger *zap.Logger) (map[string]provider.Provider, error) {
+	acceptedHostnames, err := parseAcceptedHostnames(mf.AcceptedHostnames)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache *provider.ManifestCache
+	if mf.CacheDir != "" {
+		cache = &provider.ManifestCache{
+			Dir:     filepath.Join(mf.CacheDir, "manifests"),
+			TTL:     mf.CacheTTL,
+			Refresh: mf.Refresh,
+		}
+	}
+
+	pluginDirs := []string{mf.PluginDir}
+	if mf.PluginPath {
+		pluginDirs = append(pluginDirs, filepath.SplitList(os.Getenv("PATH"))...)
+	}
+
+	return bundle.NewProviderBundle(bundle.Options{
+		Logger:                  logger,
+		Cache:                   cache,
+		AcceptedHostnames:       acceptedHostnames,
+		JavaLauncherManifestURL: mf.JavaManifestURL,
+		JavaMirrorURL:           mf.JavaMirrorURL,
+		BuildToolsWorkDir:       store.BuildToolsDir(storeDir),
+		DescriptorDir:           mf.DescriptorDir,
+		PluginDirs:              pluginDirs,
+	})
+}
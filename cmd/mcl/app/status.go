@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	"github.com/snugfox/mcl/internal/log"
+	"github.com/snugfox/mcl/pkg/status"
+)
+
+// Output formats of the MCL status command
+const (
+	statusOutputText string = "text"
+	statusOutputJSON string = "json"
+)
+
+// Editions supported by the MCL status command
+const (
+	statusEditionJava    string = "java"
+	statusEditionBedrock string = "bedrock"
+)
+
+// StatusFlags contains the flags for the MCL status command
+type StatusFlags struct {
+	Edition string
+	Address string
+	Legacy  bool
+	Output  string
+	Timeout time.Duration
+}
+
+// NewStatusFlags returns a new StatusFlags object with default parameters
+func NewStatusFlags() *StatusFlags {
+	return &StatusFlags{
+		Edition: statusEditionJava,
+		Address: "localhost", // Default port of the edition, or SRV record
+		Legacy:  false,       // Minecraft 1.7 and later
+		Output:  statusOutputText,
+		Timeout: 5 * time.Second,
+	}
+}
+
+// FlagSet returns a new pflag.FlagSet with MCL status command flags
+func (sf *StatusFlags) FlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("status", pflag.ExitOnError)
+	fs.StringVar(&sf.Edition, "edition", sf.Edition, "Minecraft edition of the server (java or bedrock)")
+	fs.StringVar(&sf.Address, "address", sf.Address, "Address of the server as host or host:port")
+	fs.BoolVar(&sf.Legacy, "legacy", sf.Legacy, "Use the legacy ping of Minecraft 1.6 for Java Edition servers prior to Minecraft 1.7")
+	fs.StringVar(&sf.Output, "output", sf.Output, "Output format (text or json)")
+	fs.DurationVar(&sf.Timeout, "timeout", sf.Timeout, "Timeout for the ping; zero for no timeout")
+	return fs
+}
+
+// NewStatusCommand creates a new *cobra.Command for the MCL status command with
+// default flags.
+func NewStatusCommand() *cobra.Command {
+	statusFlags := NewStatusFlags()
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Pings a server and prints its version, MOTD, player counts, and latency",
+		Run: func(cmd *cobra.Command, _ []string) {
+			logger := log.NewLogger(os.Stderr, false)
+			defer logger.Sync()
+
+			if statusFlags.Output != statusOutputText && statusFlags.Output != statusOutputJSON {
+				logger.Fatal(
+					"Invalid output format",
+					zap.String("output", statusFlags.Output),
+				)
+			}
+
+			ctx := context.Background()
+			if statusFlags.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, statusFlags.Timeout)
+				defer cancel()
+			}
+			var ping func(context.Context, string) (*status.Status, error)
+			switch {
+			case statusFlags.Edition == statusEditionBedrock && statusFlags.Legacy:
+				logger.Fatal("Legacy ping is only supported for Java Edition servers")
+			case statusFlags.Edition == statusEditionBedrock:
+				ping = status.PingBedrock
+			case statusFlags.Edition == statusEditionJava && statusFlags.Legacy:
+				ping = status.PingJavaLegacy
+			case statusFlags.Edition == statusEditionJava:
+				ping = status.PingJava
+			default:
+				logger.Fatal(
+					"Invalid edition",
+					zap.String("edition", statusFlags.Edition),
+				)
+			}
+			logger = logger.With(zap.String("address", statusFlags.Address))
+			st, err := ping(ctx, statusFlags.Address)
+			if err != nil {
+				logger.Fatal(
+					"Failed to ping server",
+					zap.Error(err),
+				)
+			}
+
+			if statusFlags.Output == statusOutputJSON {
+				printStatusJSON(st)
+			} else {
+				printStatusText(st)
+			}
+		},
+	}
+
+	cmd.PersistentFlags().AddFlagSet(statusFlags.FlagSet())
+
+	return cmd
+}
+
+// printStatusText prints a server status as aligned text.
+func printStatusText(st *status.Status) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "%s\t%s\n", "Version:", st.Version)
+	fmt.Fprintf(tw, "%s\t%d\n", "Protocol:", st.Protocol)
+	for i, line := range strings.Split(st.MOTD, "\n") {
+		if i == 0 {
+			fmt.Fprintf(tw, "%s\t%s\n", "MOTD:", line)
+		} else {
+			fmt.Fprintf(tw, "\t%s\n", line)
+		}
+	}
+	fmt.Fprintf(tw, "%s\t%d/%d\n", "Players:", st.Players.Online, st.Players.Max)
+	for _, name := range st.Players.Sample {
+		fmt.Fprintf(tw, "\t%s\n", name)
+	}
+	if st.LevelName != "" {
+		fmt.Fprintf(tw, "%s\t%s\n", "Level Name:", st.LevelName)
+	}
+	if st.GameMode != "" {
+		fmt.Fprintf(tw, "%s\t%s\n", "Game Mode:", st.GameMode)
+	}
+	if st.ServerID != "" {
+		fmt.Fprintf(tw, "%s\t%s\n", "Server ID:", st.ServerID)
+	}
+	if st.PortIPv4 != 0 {
+		fmt.Fprintf(tw, "%s\t%d\n", "Port (IPv4):", st.PortIPv4)
+	}
+	if st.PortIPv6 != 0 {
+		fmt.Fprintf(tw, "%s\t%d\n", "Port (IPv6):", st.PortIPv6)
+	}
+	fmt.Fprintf(tw, "%s\t%s\n", "Latency:", st.Latency.Round(time.Millisecond/10))
+}
+
+// printStatusJSON prints a server status as JSON, with the latency in
+// milliseconds.
+func printStatusJSON(st *status.Status) {
+	out := struct {
+		*status.Status
+		LatencyMS float64 `json:"latencyMs"`
+	}{
+		Status:    st,
+		LatencyMS: float64(st.Latency) / float64(time.Millisecond),
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
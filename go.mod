@@ -6,4 +6,5 @@ require (
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5
 	go.uber.org/zap v1.15.0
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -1,20 +1,176 @@
 package bundle
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
 	"github.com/snugfox/mcl/pkg/provider"
 )
 
+// Options contains options for the providers created by NewProviderBundle.
+type Options struct {
+	// Logger receives output from providers during long-running operations
+	// (e.g. installers). If nil, such output is discarded.
+	Logger *zap.Logger
+
+	// Cache, if non-nil, persistently caches manifests for providers that
+	// support it.
+	Cache *provider.ManifestCache
+
+	// AcceptedHostnames maps edition ID to the hostnames accepted by its
+	// provider, overriding the provider's default. It only applies to built-in
+	// providers.
+	AcceptedHostnames map[string][]string
+
+	// JavaLauncherManifestURL and JavaMirrorURL are the launcher manifest and
+	// mirror URLs for Minecraft: Java Edition, including the vanilla server JARs
+	// of Fabric (see provider.JavaProvider). If empty, the launcher manifest
+	// provided by Mojang is used without a mirror.
+	JavaLauncherManifestURL string
+	JavaMirrorURL           string
+
+	// BuildToolsWorkDir is the work directory of the Spigot and CraftBukkit
+	// providers, which caches the repositories and dependencies of BuildTools
+	// between builds (see provider.BuildToolsProvider). If empty, BuildTools runs
+	// in a temporary directory for each build.
+	BuildToolsWorkDir string
+
+	// DescriptorDir is a directory containing descriptors for custom providers
+	// (see provider.CustomProvider). If empty or nonexistent, no custom
+	// providers are loaded.
+	DescriptorDir string
+
+	// PluginDirs are directories searched, in order, for provider plugin
+	// executables (see provider.PluginProvider). Nonexistent directories are
+	// ignored.
+	PluginDirs []string
+}
+
 // NewProviderBundle creates a new map mapping edition ID to its provider for
-// use in MCL applications.
-func NewProviderBundle() map[string]provider.Provider {
+// use in MCL applications. It returns an error if a custom provider could not
+// be loaded, or if the edition ID of a custom provider conflicts with that of
+// another provider. Plugins whose edition ID conflicts with that of another
+// provider are skipped with a warning, as unrelated executables may share
+// directories with plugins. Plugin providers must be closed once no longer
+// used (see Close).
+func NewProviderBundle(opts Options) (map[string]provider.Provider, error) {
 	bundle := make(map[string]provider.Provider)
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 
 	add := func(p provider.Provider) {
 		editionID, _ := p.Edition()
 		bundle[editionID] = p
 	}
 
-	add(&provider.JavaProvider{})
+	hosts := opts.AcceptedHostnames
+	java := &provider.JavaProvider{
+		LauncherManifestURL: opts.JavaLauncherManifestURL,
+		MirrorURL:           opts.JavaMirrorURL,
+		AcceptedHostnames:   hosts["java"],
+		Cache:               opts.Cache,
+	}
+	add(java)
+	add(&provider.PaperMCProvider{Project: "paper", AcceptedHostnames: hosts["paper"], Cache: opts.Cache})
+	add(&provider.FabricProvider{AcceptedHostnames: hosts["fabric"], Cache: opts.Cache, Java: java})
+	add(&provider.ForgeProvider{Distribution: "forge", AcceptedHostnames: hosts["forge"], Cache: opts.Cache, Logger: opts.Logger})
+	add(&provider.ForgeProvider{Distribution: "neoforge", AcceptedHostnames: hosts["neoforge"], Cache: opts.Cache, Logger: opts.Logger})
+	add(&provider.BedrockProvider{AcceptedHostnames: hosts["bedrock"], Cache: opts.Cache})
+	add(&provider.PaperMCProvider{Project: "velocity", AcceptedHostnames: hosts["velocity"], Cache: opts.Cache})
+	add(&provider.PaperMCProvider{Project: "waterfall", AcceptedHostnames: hosts["waterfall"], Cache: opts.Cache})
+	add(&provider.BungeeCordProvider{AcceptedHostnames: hosts["bungeecord"], Cache: opts.Cache})
+	add(&provider.BuildToolsProvider{Compile: "spigot", AcceptedHostnames: hosts["spigot"], Cache: opts.Cache, WorkDir: opts.BuildToolsWorkDir, Logger: opts.Logger})
+	add(&provider.BuildToolsProvider{Compile: "craftbukkit", AcceptedHostnames: hosts["craftbukkit"], Cache: opts.Cache, WorkDir: opts.BuildToolsWorkDir, Logger: opts.Logger})
+
+	// Add custom providers from their descriptors
+	customProviders, err := loadCustomProviders(opts.DescriptorDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range customProviders {
+		editionID, _ := p.Edition()
+		if _, ok := bundle[editionID]; ok {
+			return nil, errors.New("custom provider redeclares edition " + editionID)
+		}
+		p.Logger = opts.Logger
+		add(p)
+	}
+
+	// Add plugins, which are identified by their executable names so that they
+	// are not started until used
+	plugins, err := provider.DiscoverPlugins(opts.PluginDirs)
+	if err != nil {
+		return nil, err
+	}
+	for editionID, path := range plugins {
+		if _, ok := bundle[editionID]; ok {
+			logger.Warn(
+				"Skipping plugin that redeclares an edition",
+				zap.String("plugin", path),
+				zap.String("pluginEdition", editionID),
+			)
+			continue
+		}
+		p := provider.NewPluginProvider(path, editionID)
+		p.Logger = opts.Logger
+		bundle[editionID] = p
+	}
+
+	return bundle, nil
+}
 
-	return bundle
+// Close closes each provider of a bundle that holds resources (e.g. the
+// processes of plugins), returning the first error encountered.
+func Close(bundle map[string]provider.Provider) error {
+	var firstErr error
+	for _, p := range bundle {
+		if c, ok := p.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// loadCustomProviders loads a custom provider for each descriptor within a
+// directory.
+func loadCustomProviders(dir string) ([]*provider.CustomProvider, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	customProviders := make([]*provider.CustomProvider, 0)
+	for _, fi := range fis {
+		switch strings.ToLower(filepath.Ext(fi.Name())) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue // Not a descriptor
+		}
+		if fi.IsDir() {
+			continue
+		}
+
+		p, err := provider.LoadCustomProvider(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fi.Name(), err)
+		}
+		customProviders = append(customProviders, p)
+	}
+	return customProviders, nil
 }
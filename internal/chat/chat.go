@@ -0,0 +1,24 @@
+package chat
+
+import "strings"
+
+// StripFormatting removes formatting codes (e.g. §a for green text) from a
+// string.
+func StripFormatting(s string) string {
+	if !strings.ContainsRune(s, '§') {
+		return s
+	}
+	var sb strings.Builder
+	skip := false
+	for _, r := range s {
+		switch {
+		case skip:
+			skip = false
+		case r == '§':
+			skip = true
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
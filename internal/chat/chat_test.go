@@ -0,0 +1,19 @@
+package chat
+
+import "testing"
+
+func TestStripFormatting(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"A Minecraft Server", "A Minecraft Server"},
+		{"§aGreen§r and §lbold", "Green and bold"},
+		{"Trailing §", "Trailing "},
+		{"§§a", "a"},
+	}
+	for _, tt := range tests {
+		if got := StripFormatting(tt.s); got != tt.want {
+			t.Errorf("StripFormatting(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
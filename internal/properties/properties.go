@@ -0,0 +1,124 @@
+package properties
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Load reads a Java properties file (e.g. server.properties) and returns a map
+// mapping each key to its value.
+func Load(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse parses properties in the Java properties format from a reader. Keys
+// and values are separated by '=', ':', or whitespace, lines beginning with '#'
+// or '!' are comments, and lines ending with an odd number of backslashes are
+// continued on the next line. Escape sequences (e.g. \: and \u00a7) are
+// unescaped. If a key is repeated, its last value is used.
+func Parse(r io.Reader) (map[string]string, error) {
+	props := make(map[string]string)
+	s := bufio.NewScanner(r)
+	var logical strings.Builder
+	for s.Scan() {
+		line := strings.TrimLeft(s.Text(), " \t\f")
+		if logical.Len() == 0 && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+
+		if continued := trailingBackslashes(line)%2 == 1; continued {
+			logical.WriteString(line[:len(line)-1])
+			continue
+		}
+		logical.WriteString(line)
+		key, value := splitProperty(logical.String())
+		props[unescape(key)] = unescape(value)
+		logical.Reset()
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if logical.Len() > 0 { // Continued at the end of the input
+		key, value := splitProperty(logical.String())
+		props[unescape(key)] = unescape(value)
+	}
+	return props, nil
+}
+
+// trailingBackslashes returns the number of backslashes at the end of a line.
+func trailingBackslashes(line string) int {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n
+}
+
+// splitProperty splits a logical line into its escaped key and value.
+func splitProperty(line string) (key, value string) {
+	i := 0
+	for ; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' {
+			i++ // Skip the escaped character
+			continue
+		}
+		if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+			break
+		}
+	}
+	if i >= len(line) {
+		return line, ""
+	}
+	key, rest := line[:i], strings.TrimLeft(line[i:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return key, rest
+}
+
+// unescape replaces escape sequences within a key or value.
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i == len(s)-1 {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+4 < len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					sb.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
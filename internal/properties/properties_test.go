@@ -0,0 +1,87 @@
+package properties
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{
+			name:  "separators",
+			input: "a=1\nb:2\nc 3\nd = 4\ne\t:\t5\n",
+			want:  map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# comment\n! comment\n\n   \nkey=value\n  # indented comment\n",
+			want:  map[string]string{"key": "value"},
+		},
+		{
+			name:  "empty values",
+			input: "empty=\nbare\n",
+			want:  map[string]string{"empty": "", "bare": ""},
+		},
+		{
+			name:  "separators within values",
+			input: "motd=A: Minecraft = Server\n",
+			want:  map[string]string{"motd": "A: Minecraft = Server"},
+		},
+		{
+			name:  "escaped separators in keys",
+			input: "a\\=b\\:c\\ d=value\n",
+			want:  map[string]string{"a=b:c d": "value"},
+		},
+		{
+			name:  "escape sequences",
+			input: "motd=\\u00a7aGreen\\tTab\\nLine\\\\Slash\\#\n",
+			want:  map[string]string{"motd": "\u00a7aGreen\tTab\nLine\\Slash#"},
+		},
+		{
+			name:  "invalid unicode escape",
+			input: "a=\\u00zz\nb=\\u00a\n",
+			want:  map[string]string{"a": "u00zz", "b": "u00a"},
+		},
+		{
+			name:  "continued lines",
+			input: "motd=Hello, \\\n    World\nnext=1\n",
+			want:  map[string]string{"motd": "Hello, World", "next": "1"},
+		},
+		{
+			name:  "escaped backslash does not continue",
+			input: "path=C:\\\\\nnext=1\n",
+			want:  map[string]string{"path": "C:\\", "next": "1"},
+		},
+		{
+			name:  "continued at end of input",
+			input: "motd=Hello\\",
+			want:  map[string]string{"motd": "Hello"},
+		},
+		{
+			name:  "repeated keys",
+			input: "a=1\na=2\n",
+			want:  map[string]string{"a": "2"},
+		},
+		{
+			name:  "CRLF line endings",
+			input: "a=1\r\nb=2\r\n",
+			want:  map[string]string{"a": "1", "b": "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Parse error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
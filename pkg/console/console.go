@@ -0,0 +1,226 @@
+package console
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+// Number of output writes buffered for each client, beyond which a client is
+// disconnected so that it cannot stall the server
+const clientBufferSize int = 256
+
+// ErrClosed is returned when sending commands to a closed console.
+var ErrClosed = errors.New("console closed")
+
+// Console multiplexes the console of a server. It owns the server's standard
+// input, to which commands may be sent from several sources (e.g. a terminal
+// and clients of a control socket), and broadcasts the server's output to each
+// client in addition to the terminal.
+//
+// The control socket is a Unix domain socket. Each line written by a client is
+// sent to the server as a command, and all output written by the server while
+// the client is connected is streamed to it.
+type Console struct {
+	pr     *io.PipeReader
+	pw     *io.PipeWriter
+	sendMu sync.Mutex // Serializes commands
+
+	mu        sync.Mutex // Guards fields below
+	listeners []net.Listener
+	clients   map[*client]struct{}
+	closed    bool
+}
+
+// client is a client connected to the control socket.
+type client struct {
+	conn net.Conn
+	out  chan []byte // Buffered output to write to the client
+}
+
+// New returns a new console.
+func New() *Console {
+	pr, pw := io.Pipe()
+	return &Console{
+		pr:      pr,
+		pw:      pw,
+		clients: make(map[*client]struct{}),
+	}
+}
+
+// Input returns the reader from which the server reads its standard input.
+func (c *Console) Input() io.Reader {
+	return c.pr
+}
+
+// Output returns a writer for the server's output, which writes it to another
+// writer (e.g. the terminal) and broadcasts it to each client. The other
+// writer may be nil.
+func (c *Console) Output(w io.Writer) io.Writer {
+	return &outputWriter{c: c, w: w}
+}
+
+// Send sends a command to the server's standard input, followed by a newline.
+// Commands from different sources are never interleaved.
+func (c *Console) Send(command string) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if _, err := io.WriteString(c.pw, command+"\n"); err == io.ErrClosedPipe {
+		return ErrClosed
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SendLines sends each line read from a reader as a command until the reader
+// is exhausted.
+func (c *Console) SendLines(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if err := c.Send(s.Text()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// Listen creates the control socket at a path and serves clients in the
+// background until the console is closed. A stale socket left at the path by
+// a previous process is replaced, but a socket in use is not. The mode of the
+// socket is changed such that it is only accessible to the current user.
+func (c *Console) Listen(path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return errors.New("console socket " + path + " is in use")
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		l.Close()
+		return ErrClosed
+	}
+	c.listeners = append(c.listeners, l)
+	go c.serve(l)
+	return nil
+}
+
+// serve accepts clients until the listener is closed.
+func (c *Console) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		c.addClient(conn)
+	}
+}
+
+// addClient registers a connected client, streaming output to it and sending
+// its lines as commands until it disconnects.
+func (c *Console) addClient(conn net.Conn) {
+	cl := &client{
+		conn: conn,
+		out:  make(chan []byte, clientBufferSize),
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+	c.clients[cl] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		for b := range cl.out {
+			if _, err := conn.Write(b); err != nil {
+				break
+			}
+		}
+		conn.Close()
+		c.removeClient(cl)
+	}()
+	go func() {
+		// Clients may close their end for writing after sending commands while
+		// continuing to receive output, so the client is only removed once the
+		// connection fails.
+		c.SendLines(conn)
+	}()
+}
+
+// removeClient unregisters a client, closing its output channel.
+func (c *Console) removeClient(cl *client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.clients[cl]; ok {
+		delete(c.clients, cl)
+		close(cl.out)
+	}
+}
+
+// broadcast writes output to each client, disconnecting clients whose buffers
+// are full.
+func (c *Console) broadcast(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for cl := range c.clients {
+		b := make([]byte, len(p))
+		copy(b, p)
+		select {
+		case cl.out <- b:
+		default:
+			delete(c.clients, cl)
+			close(cl.out)
+		}
+	}
+}
+
+// Close closes the console, closing the server's standard input and control
+// sockets, and disconnecting all clients.
+func (c *Console) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for _, l := range c.listeners {
+		l.Close() // Also removes the socket
+	}
+	for cl := range c.clients {
+		delete(c.clients, cl)
+		close(cl.out)
+	}
+	return c.pw.Close()
+}
+
+// outputWriter is a writer for the server's output.
+type outputWriter struct {
+	c *Console
+	w io.Writer
+}
+
+func (ow *outputWriter) Write(p []byte) (int, error) {
+	ow.c.broadcast(p)
+	if ow.w == nil {
+		return len(p), nil
+	}
+	return ow.w.Write(p)
+}
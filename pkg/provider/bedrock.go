@@ -0,0 +1,486 @@
+package provider
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// BedrockProvider is a provider for the Minecraft: Bedrock Edition dedicated
+// server (BDS) for Linux provided by Mojang.
+type BedrockProvider struct {
+	// IndexURL is the URL of a version index listing available server
+	// versions. If empty, versions are discovered from the download links
+	// published by Mojang, which only include the current release and preview
+	// versions.
+	//
+	// The version index is a JSON document of the form:
+	//
+	//  {
+	//    "latest": {"release": "1.16.1.02"},
+	//    "versions": [
+	//      {"version": "1.16.1.02", "url": "https://...", "sha256": "..."}
+	//    ]
+	//  }
+	//
+	// where "sha256" is an optional hex-encoded checksum of the server archive.
+	IndexURL string
+
+	// AcceptedHostnames restricts the hostnames that the provider may request,
+	// including those of URLs listed by manifests and of redirects, to those
+	// listed and their subdomains (see AnyHostname). The hostname of the version
+	// index, or of the download links if there is none, is always accepted. If
+	// empty, only the hostnames of Mojang are accepted.
+	AcceptedHostnames []string
+
+	// Cache, if non-nil, persistently caches the manifests provided by the
+	// version index or Mojang.
+	Cache *ManifestCache
+
+	versions   []bedrockVersionInfo
+	versionMap map[string]*bedrockVersionInfo // Maps version ID to version info
+}
+
+type bedrockVersionInfo struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"` // Hex-encoded; optional
+}
+
+const (
+	// URL of the download links provided by Mojang
+	bedrockLinksURL string = "https://net-secondary.web.minecraft-services.net/api/v1.0/download/links"
+
+	// Base URL of the server archives hosted by Mojang
+	bedrockArchiveBaseURL string = "https://www.minecraft.net/bedrockdedicatedserver/bin-linux/"
+
+	// Prefix and suffix of server archive names, which surround the version
+	bedrockArchiveNamePrefix string = "bedrock-server-"
+	bedrockArchiveNameSuffix string = ".zip"
+
+	// Filename of the server archive
+	bedrockArchiveFilename string = "bedrock-server.zip"
+
+	// Filename of the server executable
+	bedrockServerFilename string = "bedrock_server"
+)
+
+// bedrockDataDirs are the directories of an extracted server that BDS loads
+// relative to its working directory, and which are linked into working
+// directories from the base directory.
+var bedrockDataDirs = []string{"behavior_packs", "resource_packs", "definitions", "config"}
+
+// bedrockConfigFiles are the default configuration files of an extracted
+// server that BDS loads relative to its working directory, and which are copied
+// into working directories if missing such that they may be edited per world.
+var bedrockConfigFiles = []string{"server.properties", "permissions.json", "allowlist.json", "whitelist.json"}
+
+// bedrockLinkChannels maps download types in the download links to the
+// channel alias they are made available under.
+var bedrockLinkChannels = map[string]string{
+	"serverBedrockLinux":        "release",
+	"serverBedrockPreviewLinux": "preview",
+}
+
+// bedrockVersionPattern matches fixed BDS version identifiers (e.g. 1.16.1.02).
+var bedrockVersionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)+$`)
+
+func (bp *BedrockProvider) fetchManifest(ctx context.Context, force bool) error {
+	if force || bp.versions == nil {
+		var versions []bedrockVersionInfo
+		var latest map[string]string
+		var err error
+		if bp.IndexURL == "" {
+			versions, latest, err = fetchBedrockLinks(ctx, bp.Cache)
+		} else {
+			versions, latest, err = fetchBedrockIndex(ctx, bp.Cache, bp.IndexURL)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Index and cache versions as we are likely to later lookup specific
+		// version information.
+		bp.versions = versions
+		bp.versionMap = make(map[string]*bedrockVersionInfo)
+		for i, vInfo := range versions {
+			bp.versionMap[vInfo.Version] = &versions[i]
+		}
+		for alias, version := range latest { // Resolve alias and add to the version map
+			vInfo, ok := bp.versionMap[version]
+			if !ok {
+				return errors.New("index references unknown version")
+			}
+			bp.versionMap[alias] = vInfo
+		}
+	}
+
+	return nil
+}
+
+// bedrockAcceptedHostnames are the hostnames accepted by default for Minecraft:
+// Bedrock Edition, which are those used by Mojang for the download links and
+// server archives.
+var bedrockAcceptedHostnames = []string{
+	"minecraft.net",
+	"minecraft-services.net",
+	"minecraft.azureedge.net",
+}
+
+func (bp *BedrockProvider) restrictHostnames(ctx context.Context) context.Context {
+	if len(bp.AcceptedHostnames) == 0 {
+		return restrictHostnames(ctx, bedrockAcceptedHostnames, bp.indexURL())
+	}
+	return restrictHostnames(ctx, bp.AcceptedHostnames, bp.indexURL())
+}
+
+// indexURL returns the URL of the version index, or of the download links
+// published by Mojang if there is no version index.
+func (bp *BedrockProvider) indexURL() string {
+	if bp.IndexURL == "" {
+		return bedrockLinksURL
+	}
+	return bp.IndexURL
+}
+
+func fetchBedrockIndex(ctx context.Context, cache *ManifestCache, indexURL string) ([]bedrockVersionInfo, map[string]string, error) {
+	var index struct {
+		Latest   map[string]string    `json:"latest"`
+		Versions []bedrockVersionInfo `json:"versions"`
+	}
+	if err := cache.getJSON(ctx, indexURL, &index); err != nil {
+		return nil, nil, err
+	}
+	return index.Versions, index.Latest, nil
+}
+
+func fetchBedrockLinks(ctx context.Context, cache *ManifestCache) ([]bedrockVersionInfo, map[string]string, error) {
+	var links struct {
+		Result struct {
+			Links []struct {
+				DownloadType string `json:"downloadType"`
+				DownloadURL  string `json:"downloadUrl"`
+			} `json:"links"`
+		} `json:"result"`
+	}
+	if err := cache.getJSON(ctx, bedrockLinksURL, &links); err != nil {
+		return nil, nil, err
+	}
+
+	versions := make([]bedrockVersionInfo, 0)
+	latest := make(map[string]string)
+	for _, link := range links.Result.Links {
+		channel, ok := bedrockLinkChannels[link.DownloadType]
+		if !ok {
+			continue
+		}
+
+		// The version is only available through the archive filename
+		filename := link.DownloadURL[strings.LastIndexByte(link.DownloadURL, '/')+1:]
+		version := strings.TrimSuffix(strings.TrimPrefix(filename, bedrockArchiveNamePrefix), bedrockArchiveNameSuffix)
+		if !bedrockVersionPattern.MatchString(version) {
+			return nil, nil, errors.New("unrecognized download URL " + link.DownloadURL)
+		}
+		versions = append(versions, bedrockVersionInfo{
+			Version: version,
+			URL:     link.DownloadURL,
+		})
+		latest[channel] = version
+	}
+	return versions, latest, nil
+}
+
+// versionInfo returns the version info for a version. Without a version index,
+// Mojang continues to host archives for versions no longer listed in its
+// download links, so any well-formed version is assumed to exist.
+func (bp *BedrockProvider) versionInfo(version string) (*bedrockVersionInfo, error) {
+	if vInfo, ok := bp.versionMap[version]; ok {
+		return vInfo, nil
+	}
+	if bp.IndexURL == "" && bedrockVersionPattern.MatchString(version) {
+		return &bedrockVersionInfo{
+			Version: version,
+			URL:     bedrockArchiveBaseURL + bedrockArchiveNamePrefix + version + bedrockArchiveNameSuffix,
+		}, nil
+	}
+	return nil, errors.New("version not found")
+}
+
+func (BedrockProvider) archivePath(baseDir string) string {
+	return filepath.Join(baseDir, bedrockArchiveFilename)
+}
+
+// Edition returns the edition ID and name for Minecraft: Bedrock Edition.
+func (BedrockProvider) Edition() (id string, name string) {
+	return "bedrock", "Minecraft: Bedrock Edition"
+}
+
+// Versions returns all available server versions for the edition. For
+// Minecraft: Bedrock Edition, it returns the versions listed by the version
+// index or, if no index is configured, the current release and preview
+// versions.
+func (bp *BedrockProvider) Versions(ctx context.Context) ([]string, error) {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchManifest(ctx, false); err != nil {
+		return nil, err
+	}
+
+	versionIDs := make([]string, 0, len(bp.versions))
+	for _, vInfo := range bp.versions {
+		versionIDs = append(versionIDs, vInfo.Version)
+	}
+	return versionIDs, nil
+}
+
+// DefaultVersion returns the default version for the edition. For Minecraft:
+// Bedrock Edition, it always returns "release".
+func (BedrockProvider) DefaultVersion() string {
+	return "release"
+}
+
+// ResolveVersion resolves a version identifier to a fixed version identifier
+// (e.g. release -> 1.16.1.02).
+func (bp *BedrockProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchManifest(ctx, false); err != nil {
+		return "", err
+	}
+
+	vInfo, err := bp.versionInfo(version)
+	if err != nil {
+		return "", err
+	}
+	return vInfo.Version, nil
+}
+
+// IsFetchNeeded returns whether the server resources for the edition and a
+// specified version are not available locally and require fetching. For
+// Minecraft: Bedrock Edition, it checks if the server archive exists locally,
+// and if so, compares its SHA-256 checksum with that provided by the version
+// index if available.
+func (bp *BedrockProvider) IsFetchNeeded(ctx context.Context, baseDir, version string) (bool, error) {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchManifest(ctx, false); err != nil {
+		return false, err
+	}
+
+	vInfo, err := bp.versionInfo(version)
+	if err != nil {
+		return false, err
+	}
+
+	archivePath := bp.archivePath(baseDir)
+	if vInfo.SHA256 == "" {
+		exists, err := fileExists(archivePath)
+		return !exists, err
+	}
+	ok, err := fileHashMatches(archivePath, sha256.New(), vInfo.SHA256)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+// Fetch fetches (downloads) server resources into a specified base directory.
+// For Minecraft: Bedrock Edition, it downloads the server archive to the base
+// directory, verifying it against the SHA-256 checksum of the index if
+// available. Any previously extracted server is invalidated.
+func (bp *BedrockProvider) Fetch(ctx context.Context, baseDir, version string) error {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchManifest(ctx, false); err != nil {
+		return err
+	}
+
+	vInfo, err := bp.versionInfo(version)
+	if err != nil {
+		return err
+	}
+
+	if err := unmarkPrepared(baseDir); err != nil {
+		return err
+	}
+	var h hash.Hash
+	if vInfo.SHA256 != "" {
+		h = sha256.New()
+	}
+	return downloadVerifiedFile(ctx, vInfo.URL, bp.archivePath(baseDir), h, vInfo.SHA256, 0)
+}
+
+// IsPrepareNeeded returns whether the server resources for the edition and a
+// specified version are not available for immediate use and required
+// additional preparation. For Minecraft: Bedrock Edition, it checks whether the
+// server archive was previously extracted in the base directory.
+func (BedrockProvider) IsPrepareNeeded(_ context.Context, baseDir, _ string) (bool, error) {
+	prepared, err := isPrepared(baseDir)
+	return !prepared, err
+}
+
+// Prepare prepares (preprocesses) fetched server resources such that they are
+// immediately useable without any further modifications. For Minecraft: Bedrock
+// Edition, it extracts the server archive into the base directory, reporting
+// the progress of the extraction to the progress observer of the context, if
+// any.
+func (bp *BedrockProvider) Prepare(ctx context.Context, baseDir, _ string) error {
+	zr, err := zip.OpenReader(bp.archivePath(baseDir))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	var total int64
+	for _, zf := range zr.File {
+		total += int64(zf.UncompressedSize64)
+	}
+	pt := newProgressTracker(ctx, bedrockArchiveFilename, total)
+	for _, zf := range zr.File {
+		err := ctx.Err()
+		if err == nil {
+			err = extractZipFile(zf, baseDir, pt)
+		}
+		if err != nil {
+			pt.finish(err)
+			return err
+		}
+	}
+	pt.finish(nil)
+
+	// Ensure the server is executable regardless of the modes in the archive
+	if err := os.Chmod(filepath.Join(baseDir, bedrockServerFilename), 0755); err != nil {
+		return err
+	}
+	return markPrepared(baseDir)
+}
+
+// extractZipFile extracts a file from a zip archive to a directory, preserving
+// its permission bits. Extracted bytes are added to a progress tracker, which
+// may be nil.
+func extractZipFile(zf *zip.File, dir string, pt *progressTracker) error {
+	path := filepath.Join(dir, filepath.FromSlash(zf.Name))
+	if path != filepath.Clean(dir) && !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return errors.New("archive file outside of directory: " + zf.Name)
+	}
+
+	mode := zf.Mode()
+	if mode.IsDir() {
+		return os.MkdirAll(path, os.ModeDir|0755)
+	}
+	if !mode.IsRegular() {
+		return errors.New("archive file is not a regular file: " + zf.Name)
+	}
+	if mode.Perm() == 0 { // Archives created without Unix permissions
+		mode = 0644
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|0755); err != nil {
+		return err
+	}
+	r, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, progressReader{r: r, pt: pt}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode.Perm()) // Existing files retain their previous mode
+}
+
+// linkBedrockData links the data directories of a server extracted to a base
+// directory into a working directory, and copies its default configuration
+// files into the working directory if missing. Links to the data directories of
+// other base directories (e.g. of previous versions) are replaced, whereas
+// directories in the working directory are left in place.
+func linkBedrockData(baseDir, workingDir string) error {
+	for _, name := range bedrockDataDirs {
+		target := filepath.Join(baseDir, name)
+		if exists, err := fileExists(target); err != nil {
+			return err
+		} else if !exists {
+			continue // Not all versions include every directory
+		}
+
+		path := filepath.Join(workingDir, name)
+		fi, err := os.Lstat(path)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		case fi.Mode()&os.ModeSymlink == 0:
+			continue // Leave directories managed in the working directory
+		default:
+			dest, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if dest == target {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+		if err := os.Symlink(target, path); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range bedrockConfigFiles {
+		src := filepath.Join(baseDir, name)
+		if exists, err := fileExists(src); err != nil {
+			return err
+		} else if !exists {
+			continue
+		}
+
+		dst := filepath.Join(workingDir, name)
+		if exists, err := fileExists(dst); err != nil {
+			return err
+		} else if exists {
+			continue
+		}
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run runs a server within a specified working directory. Server resources
+// should have been previously fetched and prepared to the same base directory
+// and for the same version prior to calling Run. Runtime arguments are ignored
+// as BDS does not require a runtime environment, and server arguments are
+// passed to the server executable. The base directory is added to the library
+// search path for the shared libraries bundled with the server. As BDS loads its
+// data and configuration relative to its working directory, the data
+// directories of the base directory are linked into the working directory, and
+// the default configuration files are copied into it if missing.
+func (bp *BedrockProvider) Run(ctx context.Context, baseDir, workingDir, version string, _, serverArgs []string) error {
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	if err := linkBedrockData(baseDir, workingDir); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(filepath.Join(baseDir, bedrockServerFilename), serverArgs...)
+	cmd.Dir = workingDir
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+baseDir)
+	return runAttached(ctx, cmd, serverStopCommand)
+}
@@ -0,0 +1,272 @@
+package provider
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeBedrockArchive writes a server archive containing a stand-in server
+// executable to a path, returning its hex-encoded SHA-256 checksum.
+func writeBedrockArchive(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{bedrockServerFilename, "server.properties"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// newBedrockIndexServer serves a directory containing a version index, as
+// returned by index, and the server archive of version 1.16.1.02 from a local
+// file server. It returns the URL of the index.
+func newBedrockIndexServer(t *testing.T, index func(baseURL, sum string) interface{}) string {
+	t.Helper()
+	dir := tempDir(t)
+	sum := writeBedrockArchive(t, filepath.Join(dir, "bedrock-server-1.16.1.02.zip"))
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	t.Cleanup(srv.Close)
+	b, err := json.Marshal(index(srv.URL, sum))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return srv.URL + "/index.json"
+}
+
+func TestBedrockIndex(t *testing.T) {
+	version := func(v, rawurl, sum string) map[string]string {
+		return map[string]string{"version": v, "url": rawurl, "sha256": sum}
+	}
+	tests := []struct {
+		name      string
+		index     func(baseURL, sum string) interface{}
+		version   string
+		want      string
+		wantErr   bool
+		wantFetch bool // Whether Fetch succeeds
+	}{
+		{
+			name: "release alias",
+			index: func(baseURL, sum string) interface{} {
+				return map[string]interface{}{
+					"latest": map[string]string{"release": "1.16.1.02"},
+					"versions": []interface{}{
+						version("1.16.0.2", baseURL+"/missing.zip", ""),
+						version("1.16.1.02", baseURL+"/bedrock-server-1.16.1.02.zip", sum),
+					},
+				}
+			},
+			version:   "release",
+			want:      "1.16.1.02",
+			wantFetch: true,
+		},
+		{
+			name: "fixed version without checksum",
+			index: func(baseURL, sum string) interface{} {
+				return map[string]interface{}{
+					"versions": []interface{}{
+						version("1.16.1.02", baseURL+"/bedrock-server-1.16.1.02.zip", ""),
+					},
+				}
+			},
+			version:   "1.16.1.02",
+			want:      "1.16.1.02",
+			wantFetch: true,
+		},
+		{
+			name: "mismatched checksum",
+			index: func(baseURL, sum string) interface{} {
+				zero := sha256.Sum256(nil)
+				return map[string]interface{}{
+					"versions": []interface{}{
+						version("1.16.1.02", baseURL+"/bedrock-server-1.16.1.02.zip", hex.EncodeToString(zero[:])),
+					},
+				}
+			},
+			version: "1.16.1.02",
+			want:    "1.16.1.02",
+		},
+		{
+			name: "unlisted version",
+			index: func(baseURL, sum string) interface{} {
+				return map[string]interface{}{
+					"versions": []interface{}{
+						version("1.16.1.02", baseURL+"/bedrock-server-1.16.1.02.zip", sum),
+					},
+				}
+			},
+			version: "1.16.0.2",
+			wantErr: true,
+		},
+		{
+			name: "alias of unknown version",
+			index: func(baseURL, sum string) interface{} {
+				return map[string]interface{}{
+					"latest":   map[string]string{"release": "1.16.0.2"},
+					"versions": []interface{}{},
+				}
+			},
+			version: "release",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bp := &BedrockProvider{IndexURL: newBedrockIndexServer(t, tt.index)}
+			got, err := bp.ResolveVersion(ctx, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveVersion(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Fatalf("ResolveVersion(%q) = %q, want %q", tt.version, got, tt.want)
+			}
+
+			baseDir := tempDir(t)
+			err = bp.Fetch(ctx, baseDir, got)
+			if (err == nil) != tt.wantFetch {
+				t.Fatalf("Fetch error = %v, want success %v", err, tt.wantFetch)
+			}
+			if !tt.wantFetch {
+				return
+			}
+			if needed, err := bp.IsFetchNeeded(ctx, baseDir, got); err != nil || needed {
+				t.Errorf("IsFetchNeeded after Fetch = %v, %v; want false, nil", needed, err)
+			}
+			if err := bp.Prepare(ctx, baseDir, got); err != nil {
+				t.Fatalf("Prepare error = %v", err)
+			}
+			fi, err := os.Stat(filepath.Join(baseDir, bedrockServerFilename))
+			if err != nil || fi.Mode().Perm()&0100 == 0 {
+				t.Errorf("server executable not extracted as executable: %v", err)
+			}
+		})
+	}
+}
+
+// stubBedrockServerScript stands in for the server executable. It fails unless
+// the data directories and configuration are present in its working directory,
+// and prints its configuration otherwise.
+const stubBedrockServerScript = `#!/bin/sh
+[ -f behavior_packs/pack.json ] && [ -f resource_packs/pack.json ] && [ -f server.properties ] || exit 1
+cat server.properties
+`
+
+func TestBedrockRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub server requires a POSIX shell")
+	}
+	baseDir := tempDir(t)
+	files := map[string]string{
+		bedrockServerFilename:            stubBedrockServerScript,
+		"behavior_packs/pack.json":       "base",
+		"resource_packs/pack.json":       "base",
+		"server.properties":              "level-name=default\n",
+		"bedrock_server_how_to.html":     "",
+		"definitions/biomes/plains.json": "",
+	}
+	for name, body := range files {
+		path := filepath.Join(baseDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, workingDir string)
+		want  string // Output of the server
+	}{
+		{
+			name:  "empty working directory",
+			setup: func(t *testing.T, workingDir string) {},
+			want:  "level-name=default\n",
+		},
+		{
+			name: "existing configuration and packs",
+			setup: func(t *testing.T, workingDir string) {
+				if err := ioutil.WriteFile(filepath.Join(workingDir, "server.properties"), []byte("level-name=edited\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Mkdir(filepath.Join(workingDir, "resource_packs"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(workingDir, "resource_packs", "pack.json"), []byte("custom"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				// Link left by a previous version
+				if err := os.Symlink(tempDir(t), filepath.Join(workingDir, "behavior_packs")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "level-name=edited\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workingDir := tempDir(t)
+			tt.setup(t, workingDir)
+
+			var stdout strings.Builder
+			ctx := WithRunOptions(context.Background(), RunOptions{
+				Stdin:  strings.NewReader(""),
+				Stdout: &stdout,
+				Stderr: ioutil.Discard,
+			})
+			bp := &BedrockProvider{}
+			if err := bp.Run(ctx, baseDir, workingDir, "1.16.1.02", nil, nil); err != nil {
+				t.Fatalf("Run error = %v", err)
+			}
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("server output = %q, want %q", got, tt.want)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(workingDir, "behavior_packs", "pack.json"))
+			if err != nil || string(b) != "base" {
+				t.Errorf("behavior pack = %q, %v; want %q", b, err, "base")
+			}
+			if _, err := os.Stat(filepath.Join(workingDir, "definitions")); err != nil {
+				t.Errorf("definitions not linked: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+
+	"github.com/snugfox/mcl/pkg/store"
+)
+
+type blobStoreKey struct{}
+
+// WithBlobStore returns a copy of a parent context in which providers share
+// server resources between base directories through a blob store. Resources
+// with known SHA-1 or SHA-256 checksums are downloaded once into the blob store
+// and linked into each base directory, and other resources installed into base
+// directories (e.g. libraries) may be added to the blob store after
+// preparation.
+func WithBlobStore(parent context.Context, bs *store.BlobStore) context.Context {
+	return context.WithValue(parent, blobStoreKey{}, bs)
+}
+
+// blobStore returns the blob store for a context, or nil if there is none.
+func blobStore(ctx context.Context) *store.BlobStore {
+	bs, _ := ctx.Value(blobStoreKey{}).(*store.BlobStore)
+	return bs
+}
+
+// blobAlgorithm returns the blob store checksum algorithm computed by a hash,
+// as determined by its size, or an empty string if it is not supported.
+func blobAlgorithm(h hash.Hash) string {
+	switch h.Size() {
+	case sha1.Size:
+		return store.SHA1
+	case sha256.Size:
+		return store.SHA256
+	default:
+		return ""
+	}
+}
+
+// downloadBlob downloads the resource at a URL into the blob store of a
+// context, verifying it as downloadVerifiedFile does, and links it to a file.
+// The resource is only downloaded if its blob does not already exist or fails
+// verification. It returns false and a nil error if the context has no blob
+// store, or if the resource cannot be stored (e.g. an unsupported checksum),
+// in which case the resource should be downloaded directly.
+func downloadBlob(ctx context.Context, rawurl, path string, h hash.Hash, expectedHex string, size int64) (bool, error) {
+	bs := blobStore(ctx)
+	if bs == nil || h == nil {
+		return false, nil
+	}
+	algorithm := blobAlgorithm(h)
+	if algorithm == "" {
+		return false, nil
+	}
+	blobPath, err := bs.Path(algorithm, expectedHex)
+	if err != nil {
+		return false, nil
+	}
+
+	// Blobs shared through hard links may have been modified in place, so they
+	// are verified before use
+	ok, err := fileHashMatches(blobPath, h, expectedHex)
+	h.Reset()
+	if err != nil {
+		return true, err
+	}
+	if !ok {
+		// Lock the blob so that concurrent processes do not download it into the
+		// same partial file, and verify it again as another process may have
+		// downloaded it in the meantime.
+		lock, err := bs.Lock(ctx, algorithm, expectedHex)
+		if err != nil {
+			return true, err
+		}
+		defer lock.Unlock()
+		ok, err := fileHashMatches(blobPath, h, expectedHex)
+		h.Reset()
+		if err != nil {
+			return true, err
+		}
+		if !ok {
+			if err := downloadFileTo(ctx, rawurl, blobPath, h, expectedHex, size); err != nil {
+				return true, err
+			}
+		}
+	}
+	if _, err := bs.Link(algorithm, expectedHex, path); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// addBlobDir adds the files within a directory to the blob store of a context,
+// if any, such that identical files are shared with other base directories.
+// The directory is ignored if it does not exist.
+func addBlobDir(ctx context.Context, dir string) error {
+	bs := blobStore(ctx)
+	if bs == nil {
+		return nil
+	}
+	if exists, err := fileExists(dir); err != nil || !exists {
+		return err
+	}
+	return bs.AddDir(dir)
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/snugfox/mcl/pkg/store"
+)
+
+func TestDownloadBlob(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	sum := sha256Hex(content)
+	ds := newDownloadServer(t, serveResource(`"v1"`, content))
+	storeDir := tempDir(t)
+	bs := store.NewBlobStore(storeDir)
+	ctx := WithBlobStore(context.Background(), bs)
+	blobPath, err := bs.Path(store.SHA256, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resources are downloaded into the blob store once and linked to each file
+	for i, version := range []string{"1.16.4", "1.16.5"} {
+		path := filepath.Join(storeDir, "java", version, "server.jar")
+		if err := downloadVerifiedFile(ctx, ds.URL, path, sha256.New(), sum, int64(len(content))); err != nil {
+			t.Fatalf("download error = %v", err)
+		}
+		checkDownloaded(t, path, content)
+		if n := len(ds.received()); n != 1 {
+			t.Errorf("received %d requests after %d downloads, want 1", n, i+1)
+		}
+	}
+	checkDownloaded(t, blobPath, content)
+
+	// Corrupted blobs are downloaded again rather than linked
+	if err := ioutil.WriteFile(blobPath, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(storeDir, "java", "1.16.3", "server.jar")
+	if err := downloadVerifiedFile(ctx, ds.URL, path, sha256.New(), sum, int64(len(content))); err != nil {
+		t.Fatalf("download error = %v", err)
+	}
+	checkDownloaded(t, path, content)
+	checkDownloaded(t, blobPath, content)
+	if n := len(ds.received()); n != 2 {
+		t.Errorf("received %d requests after corrupting the blob, want 2", n)
+	}
+}
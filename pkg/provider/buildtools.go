@@ -0,0 +1,374 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/snugfox/mcl/pkg/store"
+)
+
+// BuildToolsProvider is a provider for the Spigot and CraftBukkit servers,
+// which are compiled locally by SpigotMC's BuildTools during Prepare.
+type BuildToolsProvider struct {
+	// Compile is the server compiled by BuildTools, either "spigot" or
+	// "craftbukkit". If empty, "spigot" is used.
+	Compile string
+
+	// BuildToolsURL is the URL of the BuildTools JAR. If empty, the latest
+	// successful build from the SpigotMC Jenkins CI server is used.
+	BuildToolsURL string
+
+	// VersionsURL is the URL of the directory listing of versions available to
+	// BuildTools. If empty, the official SpigotMC listing is used.
+	VersionsURL string
+
+	// AcceptedHostnames restricts the hostnames that the provider may request,
+	// including those of redirects, to those listed and their subdomains (see
+	// AnyHostname). The hostnames of the BuildTools and versions URLs are always
+	// accepted. If empty, only the hostnames of SpigotMC are accepted.
+	AcceptedHostnames []string
+
+	// Cache, if non-nil, persistently caches the manifests provided by SpigotMC.
+	Cache *ManifestCache
+
+	// WorkDir is the directory BuildTools runs in, which caches repositories and
+	// dependencies between builds and may be shared between base directories
+	// (e.g. by store.BuildToolsDir). It is locked while BuildTools runs so that
+	// concurrent processes do not compile in the same tree. If empty, BuildTools
+	// runs in a temporary directory that is removed once it completes.
+	WorkDir string
+
+	// Logger receives the output of BuildTools while preparing servers. If nil,
+	// BuildTools output is discarded.
+	Logger *zap.Logger
+
+	versions []string // Versions in ascending order
+}
+
+const (
+	// URL of the BuildTools JAR provided by SpigotMC
+	buildToolsURL string = "https://hub.spigotmc.org/jenkins/job/BuildTools/lastSuccessfulBuild/artifact/target/BuildTools.jar"
+
+	// URL of the directory listing of versions available to BuildTools
+	buildToolsVersionsURL string = "https://hub.spigotmc.org/versions/"
+
+	// Filename of the BuildTools JAR
+	buildToolsJARFilename string = "BuildTools.jar"
+
+	// Server compiled when none is specified
+	defaultBuildToolsCompile string = "spigot"
+)
+
+// buildToolsCompileNames maps servers compiled by BuildTools to their full
+// names.
+var buildToolsCompileNames = map[string]string{
+	"spigot":      "Spigot",
+	"craftbukkit": "CraftBukkit",
+}
+
+var (
+	// buildToolsVersionLinkPattern matches links to version files in the
+	// versions directory listing.
+	buildToolsVersionLinkPattern = regexp.MustCompile(`href="([^"/]+)\.json"`)
+
+	// buildToolsVersionPattern matches game versions (e.g. 1.16.1 or 1.14-pre5)
+	// as opposed to the BuildTools build numbers also present in the listing.
+	buildToolsVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+)*(-[0-9A-Za-z]+)?$`)
+)
+
+func (bp *BuildToolsProvider) compile() string {
+	if bp.Compile == "" {
+		return defaultBuildToolsCompile
+	}
+	return bp.Compile
+}
+
+func (bp *BuildToolsProvider) buildToolsURL() string {
+	if bp.BuildToolsURL == "" {
+		return buildToolsURL
+	}
+	return bp.BuildToolsURL
+}
+
+func (bp *BuildToolsProvider) versionsURL() string {
+	if bp.VersionsURL == "" {
+		return buildToolsVersionsURL
+	}
+	return bp.VersionsURL
+}
+
+// buildToolsAcceptedHostnames are the hostnames accepted by default for
+// BuildTools, which are those used by SpigotMC for BuildTools and its version
+// manifests.
+var buildToolsAcceptedHostnames = []string{
+	"spigotmc.org",
+}
+
+func (bp *BuildToolsProvider) restrictHostnames(ctx context.Context) context.Context {
+	if len(bp.AcceptedHostnames) == 0 {
+		return restrictHostnames(ctx, buildToolsAcceptedHostnames, bp.buildToolsURL(), bp.versionsURL())
+	}
+	return restrictHostnames(ctx, bp.AcceptedHostnames, bp.buildToolsURL(), bp.versionsURL())
+}
+
+func (bp *BuildToolsProvider) fetchVersions(ctx context.Context, force bool) error {
+	if force || bp.versions == nil {
+		var listing []byte
+		err := bp.Cache.get(ctx, bp.versionsURL(), func(b []byte) error {
+			listing = b
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		versions := make([]string, 0)
+		for _, match := range buildToolsVersionLinkPattern.FindAllSubmatch(listing, -1) {
+			if version := string(match[1]); buildToolsVersionPattern.MatchString(version) {
+				versions = append(versions, version)
+			}
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return compareGameVersions(versions[i], versions[j]) < 0
+		})
+		bp.versions = versions
+	}
+
+	return nil
+}
+
+// compareGameVersions compares two game versions (e.g. 1.16.1 and 1.9),
+// returning -1, 0, or 1 if a is less than, equal to, or greater than b. Each
+// dot-separated component is compared numerically, and pre-release versions
+// (e.g. 1.14-pre5) precede their releases. Pre-releases are ordered by their
+// label and then numerically by their number (e.g. 1.14-pre5 precedes
+// 1.14-pre10, which precedes 1.14-rc1).
+func compareGameVersions(a, b string) int {
+	aRelease, aPre := splitPreRelease(a)
+	bRelease, bPre := splitPreRelease(b)
+
+	aParts, bParts := strings.Split(aRelease, "."), strings.Split(bRelease, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aN, bN int
+		if i < len(aParts) {
+			aN, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bN, _ = strconv.Atoi(bParts[i])
+		}
+		switch {
+		case aN < bN:
+			return -1
+		case aN > bN:
+			return 1
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "": // Releases follow their pre-releases
+		return 1
+	case bPre == "":
+		return -1
+	}
+
+	aLabel, aN := splitPreReleaseNumber(aPre)
+	bLabel, bN := splitPreReleaseNumber(bPre)
+	switch {
+	case aLabel < bLabel:
+		return -1
+	case aLabel > bLabel:
+		return 1
+	case aN < bN:
+		return -1
+	case aN > bN:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func splitPreRelease(version string) (string, string) {
+	if i := strings.IndexByte(version, '-'); i >= 0 {
+		return version[:i], version[i+1:]
+	}
+	return version, ""
+}
+
+// splitPreReleaseNumber splits a pre-release (e.g. pre5) into its label and
+// number. The number is zero if the pre-release has none.
+func splitPreReleaseNumber(pre string) (string, int) {
+	i := len(pre)
+	for i > 0 && pre[i-1] >= '0' && pre[i-1] <= '9' {
+		i--
+	}
+	n, _ := strconv.Atoi(pre[i:])
+	return pre[:i], n
+}
+
+func (BuildToolsProvider) buildToolsPath(baseDir string) string {
+	return filepath.Join(baseDir, buildToolsJARFilename)
+}
+
+func (bp *BuildToolsProvider) jarPath(baseDir, version string) string {
+	return filepath.Join(baseDir, bp.compile()+"-"+version+".jar")
+}
+
+// Edition returns the edition ID and name for the server compiled by
+// BuildTools.
+func (bp *BuildToolsProvider) Edition() (id string, name string) {
+	id = bp.compile()
+	name, ok := buildToolsCompileNames[id]
+	if !ok {
+		name = id
+	}
+	return id, name
+}
+
+// Versions returns all available server versions for the edition. For
+// BuildTools, it returns all game versions that BuildTools is able to compile.
+func (bp *BuildToolsProvider) Versions(ctx context.Context) ([]string, error) {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchVersions(ctx, false); err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, len(bp.versions))
+	copy(versions, bp.versions)
+	return versions, nil
+}
+
+// DefaultVersion returns the default version for the edition. For BuildTools,
+// it always returns "latest".
+func (BuildToolsProvider) DefaultVersion() string {
+	return "latest"
+}
+
+// ResolveVersion resolves a version identifier to a fixed version identifier.
+// For BuildTools, "latest" resolves to the latest game version that is not a
+// pre-release.
+func (bp *BuildToolsProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchVersions(ctx, false); err != nil {
+		return "", err
+	}
+
+	if version == "latest" {
+		for i := len(bp.versions) - 1; i >= 0; i-- {
+			if _, pre := splitPreRelease(bp.versions[i]); pre == "" {
+				return bp.versions[i], nil
+			}
+		}
+		return "", errors.New("no versions available")
+	}
+
+	for _, v := range bp.versions {
+		if v == version {
+			return v, nil
+		}
+	}
+	return "", errors.New("version not found")
+}
+
+// IsFetchNeeded returns whether the server resources for the edition and a
+// specified version are not available locally and require fetching. For
+// BuildTools, it checks whether either the compiled server JAR or the
+// BuildTools JAR exists locally.
+func (bp *BuildToolsProvider) IsFetchNeeded(_ context.Context, baseDir, version string) (bool, error) {
+	for _, path := range []string{bp.jarPath(baseDir, version), bp.buildToolsPath(baseDir)} {
+		if exists, err := fileExists(path); err != nil || exists {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Fetch fetches (downloads) server resources into a specified base directory.
+// For BuildTools, it downloads the BuildTools JAR to the base directory.
+func (bp *BuildToolsProvider) Fetch(ctx context.Context, baseDir, _ string) error {
+	ctx = bp.restrictHostnames(ctx)
+	return downloadFile(ctx, bp.buildToolsURL(), bp.buildToolsPath(baseDir))
+}
+
+// IsPrepareNeeded returns whether the server resources for the edition and a
+// specified version are not available for immediate use and required
+// additional preparation. For BuildTools, it checks whether a server JAR was
+// previously compiled for the version.
+func (bp *BuildToolsProvider) IsPrepareNeeded(_ context.Context, baseDir, version string) (bool, error) {
+	exists, err := fileExists(bp.jarPath(baseDir, version))
+	return !exists, err
+}
+
+// Prepare prepares (preprocesses) fetched server resources such that they are
+// immediately useable without any further modifications. For BuildTools, it
+// runs BuildTools to compile the server for the version into the base
+// directory, logging the BuildTools output. The work directory is locked while
+// BuildTools runs, waiting on any other process compiling in it. BuildTools is
+// terminated if the context is cancelled.
+func (bp *BuildToolsProvider) Prepare(ctx context.Context, baseDir, version string) error {
+	absBaseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	workDir := bp.WorkDir
+	if workDir == "" {
+		if workDir, err = ioutil.TempDir("", "mcl-buildtools-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(workDir)
+	} else {
+		lock, err := store.LockBaseDir(ctx, workDir, 0, func() {
+			if bp.Logger != nil {
+				bp.Logger.Info("Waiting for another process to release the BuildTools work directory", zap.String("workDir", workDir))
+			}
+		})
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
+
+	args := []string{
+		"-jar", bp.buildToolsPath(absBaseDir),
+		"--rev", version,
+		"--output-dir", absBaseDir,
+	}
+	if compile := bp.compile(); compile != defaultBuildToolsCompile {
+		args = append(args, "--compile", compile)
+	}
+	cmd := exec.CommandContext(ctx, "java", args...)
+	cmd.Dir = workDir
+	pt := newProgressTracker(ctx, "BuildTools", 0)
+	if err := runLogged(cmd, bp.Logger, pt); err != nil {
+		return err
+	}
+
+	// BuildTools may exit successfully without producing a server (e.g. when
+	// the version is not supported by the compiled server).
+	if exists, err := fileExists(bp.jarPath(baseDir, version)); err != nil {
+		return err
+	} else if !exists {
+		return errors.New("buildtools did not produce a server JAR")
+	}
+	return nil
+}
+
+// Run runs a server within a specified working directory. Server resources
+// should have been previously fetched and prepared to the same base directory
+// and for the same version prior to calling Run. Runtime arguments are passed
+// as JVM options and server arguments are passed to the server JAR. Either
+// argument parameter may be nil if no arguments need to be specified.
+func (bp *BuildToolsProvider) Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error {
+	return runJAR(ctx, bp.jarPath(baseDir, version), workingDir, runtimeArgs, serverArgs, serverStopCommand)
+}
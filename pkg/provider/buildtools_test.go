@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompareGameVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.16.1", "1.16.1", 0},
+		{"1.16", "1.16.0", 0},
+		{"1.9", "1.16.1", -1},
+		{"1.16.1", "1.16", 1},
+		{"1.14-pre5", "1.14", -1},
+		{"1.14", "1.14-pre5", 1},
+		{"1.14-pre5", "1.14-pre10", -1},
+		{"1.14-pre10", "1.14-pre5", 1},
+		{"1.14-pre10", "1.14-rc1", -1},
+		{"1.14-rc1", "1.14-rc1", 0},
+		{"1.13.2", "1.14-pre1", -1},
+	}
+	for _, tt := range tests {
+		if got := compareGameVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareGameVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// stubBuildToolsScript stands in for java running BuildTools. It records the
+// directory it ran in and writes a server JAR for the revision to the output
+// directory, unless the revision is "unsupported".
+const stubBuildToolsScript = `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--rev) rev="$2"; shift ;;
+	--output-dir) out="$2"; shift ;;
+	--compile) compile="$2"; shift ;;
+	esac
+	shift
+done
+pwd > "$out/workdir"
+[ "$rev" = unsupported ] && exit 0
+echo "server $rev" > "$out/${compile:-spigot}-$rev.jar"
+`
+
+// installStubJava places a java executable running script first in PATH for
+// the duration of the test.
+func installStubJava(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stub java requires a POSIX shell")
+	}
+	binDir := tempDir(t)
+	if err := ioutil.WriteFile(filepath.Join(binDir, "java"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+}
+
+func TestBuildToolsPrepare(t *testing.T) {
+	installStubJava(t, stubBuildToolsScript)
+
+	tests := []struct {
+		compile       string
+		version       string
+		sharedWorkDir bool
+		wantErr       bool
+	}{
+		{compile: "spigot", version: "1.16.1", sharedWorkDir: true},
+		{compile: "craftbukkit", version: "1.16.1", sharedWorkDir: true},
+		{compile: "spigot", version: "1.16.1"},
+		{compile: "spigot", version: "unsupported", sharedWorkDir: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		name := tt.compile + "-" + tt.version
+		if !tt.sharedWorkDir {
+			name += "-temporary"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			bp := &BuildToolsProvider{Compile: tt.compile}
+			if tt.sharedWorkDir {
+				bp.WorkDir = filepath.Join(tempDir(t), ".buildtools")
+			}
+			baseDir := tempDir(t)
+			if err := ioutil.WriteFile(bp.buildToolsPath(baseDir), []byte("fake"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if needed, err := bp.IsPrepareNeeded(ctx, baseDir, tt.version); err != nil || !needed {
+				t.Fatalf("IsPrepareNeeded before Prepare = %v, %v; want true, nil", needed, err)
+			}
+			err := bp.Prepare(ctx, baseDir, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Prepare error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// BuildTools runs in the shared work directory if any, and otherwise in
+			// a temporary directory outside of the base directory that is removed
+			// once it completes
+			b, err := ioutil.ReadFile(filepath.Join(baseDir, "workdir"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			workDir := strings.TrimSpace(string(b))
+			if tt.sharedWorkDir {
+				if wantWorkDir, _ := filepath.EvalSymlinks(bp.WorkDir); workDir != wantWorkDir {
+					t.Errorf("BuildTools ran in %s, want %s", workDir, wantWorkDir)
+				}
+			} else {
+				if realBaseDir, _ := filepath.EvalSymlinks(baseDir); strings.HasPrefix(workDir, realBaseDir) {
+					t.Errorf("BuildTools ran in %s, want outside of base directory", workDir)
+				}
+				if _, err := os.Stat(workDir); !os.IsNotExist(err) {
+					t.Errorf("temporary work directory %s not removed: %v", workDir, err)
+				}
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if needed, err := bp.IsPrepareNeeded(ctx, baseDir, tt.version); err != nil || needed {
+				t.Errorf("IsPrepareNeeded after Prepare = %v, %v; want false, nil", needed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package provider
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"hash"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BungeeCordProvider is a provider for the BungeeCord proxy server published
+// through the SpigotMC Jenkins CI server.
+type BungeeCordProvider struct {
+	// JobURL is the URL of the Jenkins job that builds BungeeCord. If empty,
+	// the official BungeeCord job is used.
+	JobURL string
+
+	// AcceptedHostnames restricts the hostnames that the provider may request,
+	// including those of URLs listed by manifests and of redirects, to those
+	// listed and their subdomains (see AnyHostname). The hostname of the job URL
+	// is always accepted. If empty, only the hostnames of SpigotMC's Jenkins
+	// instance are accepted.
+	AcceptedHostnames []string
+
+	// Cache, if non-nil, persistently caches the manifests provided by the
+	// Jenkins job.
+	Cache *ManifestCache
+
+	builds   []int                            // Successful builds in descending order
+	buildMap map[int]*bungeeCordBuildResource // Maps build number to its artifact
+}
+
+type bungeeCordBuildResource struct {
+	RelativePath string
+	MD5          string // Hex-encoded; empty if not fingerprinted
+}
+
+const (
+	// URL of the Jenkins job that builds BungeeCord
+	bungeeCordJobURL string = "https://ci.md-5.net/job/BungeeCord"
+
+	// Filename of the server JAR artifact
+	bungeeCordJARFilename string = "BungeeCord.jar"
+)
+
+// bungeeCordAcceptedHostnames are the hostnames accepted by default for
+// BungeeCord, which are those of the Jenkins instance of SpigotMC.
+var bungeeCordAcceptedHostnames = []string{
+	"md-5.net",
+}
+
+func (bp *BungeeCordProvider) restrictHostnames(ctx context.Context) context.Context {
+	if len(bp.AcceptedHostnames) == 0 {
+		return restrictHostnames(ctx, bungeeCordAcceptedHostnames, bp.jobURL())
+	}
+	return restrictHostnames(ctx, bp.AcceptedHostnames, bp.jobURL())
+}
+
+func (bp *BungeeCordProvider) jobURL(elem ...string) string {
+	jobURL := bp.JobURL
+	if jobURL == "" {
+		jobURL = bungeeCordJobURL
+	}
+	return strings.Join(append([]string{strings.TrimSuffix(jobURL, "/")}, elem...), "/")
+}
+
+func (bp *BungeeCordProvider) fetchBuilds(ctx context.Context, force bool) error {
+	if force || bp.builds == nil {
+		var job struct {
+			Builds []struct {
+				Number int    `json:"number"`
+				Result string `json:"result"`
+			} `json:"allBuilds"`
+		}
+		if err := bp.Cache.getJSON(ctx, bp.jobURL("api/json?tree=allBuilds[number,result]"), &job); err != nil {
+			return err
+		}
+
+		builds := make([]int, 0, len(job.Builds))
+		for _, build := range job.Builds {
+			if build.Result == "SUCCESS" { // Filter failed and in-progress builds
+				builds = append(builds, build.Number)
+			}
+		}
+		bp.builds = builds
+	}
+
+	return nil
+}
+
+func (bp *BungeeCordProvider) fetchBuildResource(ctx context.Context, build int, force bool) (*bungeeCordBuildResource, error) {
+	resource, ok := bp.buildMap[build]
+	if force || !ok {
+		var buildInfo struct {
+			Artifacts []struct {
+				FileName     string `json:"fileName"`
+				RelativePath string `json:"relativePath"`
+			} `json:"artifacts"`
+			Fingerprint []struct {
+				FileName string `json:"fileName"`
+				Hash     string `json:"hash"` // MD5
+			} `json:"fingerprint"`
+		}
+		rawurl := bp.jobURL(strconv.Itoa(build), "api/json?tree=artifacts[fileName,relativePath],fingerprint[fileName,hash]")
+		if err := bp.Cache.getJSON(ctx, rawurl, &buildInfo); err != nil {
+			return nil, err
+		}
+
+		resource = nil
+		for _, artifact := range buildInfo.Artifacts {
+			if artifact.FileName == bungeeCordJARFilename {
+				resource = &bungeeCordBuildResource{RelativePath: artifact.RelativePath}
+				break
+			}
+		}
+		if resource == nil {
+			return nil, errors.New("build has no server artifact")
+		}
+		for _, fingerprint := range buildInfo.Fingerprint {
+			if fingerprint.FileName == bungeeCordJARFilename {
+				resource.MD5 = fingerprint.Hash
+				break
+			}
+		}
+
+		if bp.buildMap == nil {
+			bp.buildMap = make(map[int]*bungeeCordBuildResource)
+		}
+		bp.buildMap[build] = resource
+	}
+
+	return resource, nil
+}
+
+// parseBuild parses a fixed version identifier into its build number. Builds
+// must have been previously fetched.
+func (bp *BungeeCordProvider) parseBuild(version string) (int, error) {
+	build, err := strconv.Atoi(version)
+	if err != nil {
+		return 0, errors.New("version not found")
+	}
+	for _, b := range bp.builds {
+		if b == build {
+			return build, nil
+		}
+	}
+	return 0, errors.New("version not found")
+}
+
+func (BungeeCordProvider) jarPath(baseDir string) string {
+	return filepath.Join(baseDir, serverJARFilename)
+}
+
+// Edition returns the edition ID and name for BungeeCord.
+func (BungeeCordProvider) Edition() (id string, name string) {
+	return "bungeecord", "BungeeCord"
+}
+
+// Versions returns all available server versions for the edition. For
+// BungeeCord, it returns the numbers of all successful CI builds.
+func (bp *BungeeCordProvider) Versions(ctx context.Context) ([]string, error) {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchBuilds(ctx, false); err != nil {
+		return nil, err
+	}
+
+	versionIDs := make([]string, 0, len(bp.builds))
+	for _, build := range bp.builds {
+		versionIDs = append(versionIDs, strconv.Itoa(build))
+	}
+	return versionIDs, nil
+}
+
+// DefaultVersion returns the default version for the edition. For BungeeCord,
+// it always returns "latest".
+func (BungeeCordProvider) DefaultVersion() string {
+	return "latest"
+}
+
+// ResolveVersion resolves a version identifier to a fixed version identifier.
+// For BungeeCord, fixed versions are CI build numbers, and "latest" resolves to
+// the latest successful build.
+func (bp *BungeeCordProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchBuilds(ctx, false); err != nil {
+		return "", err
+	}
+
+	if version == "latest" {
+		if len(bp.builds) == 0 {
+			return "", errors.New("no versions available")
+		}
+		return strconv.Itoa(bp.builds[0]), nil
+	}
+
+	build, err := bp.parseBuild(version)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(build), nil
+}
+
+// IsFetchNeeded returns whether the server resources for the edition and a
+// specified version are not available locally and require fetching. For
+// BungeeCord, it checks if the server JAR exists locally, and if so, compares
+// the MD5 checksum with the fingerprint recorded by the CI server if available.
+func (bp *BungeeCordProvider) IsFetchNeeded(ctx context.Context, baseDir, version string) (bool, error) {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchBuilds(ctx, false); err != nil {
+		return false, err
+	}
+
+	build, err := bp.parseBuild(version)
+	if err != nil {
+		return false, err
+	}
+	resource, err := bp.fetchBuildResource(ctx, build, false)
+	if err != nil {
+		return false, err
+	}
+
+	jarPath := bp.jarPath(baseDir)
+	if resource.MD5 == "" {
+		exists, err := fileExists(jarPath)
+		return !exists, err
+	}
+	ok, err := fileHashMatches(jarPath, md5.New(), resource.MD5)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+// Fetch fetches (downloads) server resources into a specified base directory.
+// For BungeeCord, it downloads the server JAR artifact of the CI build to the
+// base directory, verifying it against the MD5 fingerprint recorded by the CI
+// server if available.
+func (bp *BungeeCordProvider) Fetch(ctx context.Context, baseDir, version string) error {
+	ctx = bp.restrictHostnames(ctx)
+	if err := bp.fetchBuilds(ctx, false); err != nil {
+		return err
+	}
+
+	build, err := bp.parseBuild(version)
+	if err != nil {
+		return err
+	}
+	resource, err := bp.fetchBuildResource(ctx, build, false)
+	if err != nil {
+		return err
+	}
+
+	rawurl := bp.jobURL(strconv.Itoa(build), "artifact", resource.RelativePath)
+	var h hash.Hash
+	if resource.MD5 != "" {
+		h = md5.New()
+	}
+	return downloadVerifiedFile(ctx, rawurl, bp.jarPath(baseDir), h, resource.MD5, 0)
+}
+
+// IsPrepareNeeded returns whether the server resources for the edition and a
+// specified version are not available for immediate use and required
+// additional preparation. For BungeeCord, it always returns false and a nil
+// error.
+func (BungeeCordProvider) IsPrepareNeeded(_ context.Context, _, _ string) (bool, error) {
+	return false, nil // There is no preparation step for BungeeCord
+}
+
+// Prepare prepares (preprocesses) fetched server resources such that they are
+// immediately useable without any further modifications. For BungeeCord, it is
+// effectively a no-op.
+func (BungeeCordProvider) Prepare(_ context.Context, _, _ string) error {
+	return nil // There is no preparation step for BungeeCord
+}
+
+// Run runs a server within a specified working directory. Server resources
+// should have been previously fetched to the same base directory and for the
+// same version prior to calling Run. Runtime arguments are passed as JVM
+// options and server arguments are passed to the server JAR. Either argument
+// parameter may be nil if no arguments need to be specified.
+func (bp *BungeeCordProvider) Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error {
+	return runJAR(ctx, bp.jarPath(baseDir), workingDir, runtimeArgs, serverArgs, proxyStopCommand)
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newBungeeCordJobServer serves a Jenkins job whose latest successful build,
+// 1500, has a server artifact with body jar and an MD5 fingerprint of sum. It
+// returns the URL of the job.
+func newBungeeCordJobServer(t *testing.T, jar, sum string) string {
+	t.Helper()
+	const artifactPath = "bootstrap/target/BungeeCord.jar"
+	job := map[string]interface{}{
+		"allBuilds": []map[string]interface{}{
+			{"number": 1501, "result": "FAILURE"},
+			{"number": 1500, "result": "SUCCESS"},
+			{"number": 1499, "result": "SUCCESS"},
+		},
+	}
+	build := map[string]interface{}{
+		"artifacts": []map[string]string{
+			{"fileName": "BungeeCord.jar", "relativePath": artifactPath},
+		},
+	}
+	if sum != "" {
+		build["fingerprint"] = []map[string]string{
+			{"fileName": "BungeeCord.jar", "hash": sum},
+		}
+	}
+
+	mux := http.NewServeMux()
+	for path, v := range map[string]interface{}{
+		"/job/BungeeCord/api/json":      job,
+		"/job/BungeeCord/1500/api/json": build,
+	} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) { w.Write(b) })
+	}
+	mux.HandleFunc("/job/BungeeCord/1500/artifact/"+artifactPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(jar))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL + "/job/BungeeCord"
+}
+
+func TestBungeeCordFetch(t *testing.T) {
+	const jar = "proxy"
+	sum := md5.Sum([]byte(jar))
+	tamperedSum := md5.Sum([]byte("tampered"))
+	tests := []struct {
+		name    string
+		sum     string // Fingerprint recorded by the CI server
+		wantErr bool
+	}{
+		{name: "matching fingerprint", sum: hex.EncodeToString(sum[:])},
+		{name: "no fingerprint", sum: ""},
+		{name: "mismatched fingerprint", sum: hex.EncodeToString(tamperedSum[:]), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			bp := &BungeeCordProvider{JobURL: newBungeeCordJobServer(t, jar, tt.sum)}
+			version, err := bp.ResolveVersion(ctx, "latest")
+			if err != nil || version != "1500" {
+				t.Fatalf("ResolveVersion(%q) = %q, %v; want %q, nil", "latest", version, err, "1500")
+			}
+
+			baseDir := tempDir(t)
+			err = bp.Fetch(ctx, baseDir, version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch error = %v, wantErr %v", err, tt.wantErr)
+			}
+			needed, err := bp.IsFetchNeeded(ctx, baseDir, version)
+			if err != nil || needed != tt.wantErr {
+				t.Errorf("IsFetchNeeded after Fetch = %v, %v; want %v, nil", needed, err, tt.wantErr)
+			}
+
+			b, err := ioutil.ReadFile(filepath.Join(baseDir, serverJARFilename))
+			if tt.wantErr {
+				if !os.IsNotExist(err) {
+					t.Errorf("server JAR with mismatched fingerprint kept: %q, %v", b, err)
+				}
+			} else if err != nil || string(b) != jar {
+				t.Errorf("server JAR = %q, %v; want %q", b, err, jar)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestCache is a persistent on-disk cache of manifests keyed by URL.
+// Cached manifests are used without revalidation until they are older than the
+// TTL, after which they are revalidated with the server using their ETag and
+// Last-Modified headers. A nil *ManifestCache disables caching.
+type ManifestCache struct {
+	// Dir is the directory containing cached manifests. If empty, caching is
+	// disabled.
+	Dir string
+
+	// TTL is the duration for which cached manifests are used without
+	// revalidation. A zero TTL revalidates cached manifests on every use.
+	TTL time.Duration
+
+	// Refresh forces manifests to be requested unconditionally regardless of
+	// the age of cached manifests, replacing them even if the server would
+	// consider them unmodified.
+	Refresh bool
+}
+
+// Format of cache entries written by ManifestCache. Entries of other formats
+// are treated as missing.
+const manifestCacheFormat int = 1
+
+// manifestCacheEntry is the on-disk representation of a cached manifest.
+type manifestCacheEntry struct {
+	Format       int       `json:"format"`
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Body         []byte    `json:"body"`
+}
+
+func (mc *ManifestCache) entryPath(rawurl string) string {
+	sum := sha256.Sum256([]byte(rawurl))
+	return filepath.Join(mc.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (mc *ManifestCache) readEntry(rawurl string) (*manifestCacheEntry, error) {
+	b, err := ioutil.ReadFile(mc.entryPath(rawurl))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entry manifestCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil || entry.URL != rawurl || entry.Format != manifestCacheFormat {
+		return nil, nil // Treat corrupt entries as missing
+	}
+	return &entry, nil
+}
+
+// writeEntry atomically writes a cache entry, replacing any existing entry for
+// the same URL.
+func (mc *ManifestCache) writeEntry(entry *manifestCacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(mc.Dir, os.ModeDir|0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(mc.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), mc.entryPath(entry.URL)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// getJSON decodes the JSON manifest at a URL into v, using and updating the
+// cache as get does.
+func (mc *ManifestCache) getJSON(ctx context.Context, rawurl string, v interface{}) error {
+	return mc.get(ctx, rawurl, func(b []byte) error {
+		return json.Unmarshal(b, v)
+	})
+}
+
+// get decodes the manifest at a URL using a decode function, using and updating
+// the cache. Manifests are only cached if they are successfully decoded. If the
+// manifest cannot be requested (e.g. no network is available or the server
+// responds with an error), a stale cached manifest is used instead. If the
+// context is offline, cached manifests are used regardless of their age. If the
+// cache is disabled, the manifest is always requested.
+func (mc *ManifestCache) get(ctx context.Context, rawurl string, decode func([]byte) error) error {
+	if mc == nil || mc.Dir == "" {
+		res, err := httpGet(ctx, rawurl)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		return decode(body)
+	}
+
+	entry, err := mc.readEntry(rawurl)
+	if err != nil {
+		return err
+	}
+	if entry != nil && (IsOffline(ctx) || !mc.Refresh && time.Since(entry.Fetched) < mc.TTL) {
+		return decode(entry.Body)
+	}
+	if IsOffline(ctx) {
+		return offlineError(rawurl)
+	}
+
+	// Request the manifest, conditionally if it is already cached and not being
+	// refreshed
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if entry != nil && !mc.Refresh {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	useStale := func(err error) error {
+		if entry != nil && ctx.Err() == nil {
+			return decode(entry.Body) // Use the stale manifest
+		}
+		return err
+	}
+	res, err := doRequest(req)
+	if err != nil {
+		return useStale(err)
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotModified && entry != nil && !mc.Refresh:
+		entry.Fetched = time.Now()
+	case res.StatusCode == http.StatusOK:
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return useStale(err)
+		}
+		entry = &manifestCacheEntry{
+			Format:       manifestCacheFormat,
+			URL:          rawurl,
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+			Fetched:      time.Now(),
+			Body:         body,
+		}
+	default:
+		return useStale(fmt.Errorf("unexpected response %q from %s", res.Status, rawurl))
+	}
+
+	if err := decode(entry.Body); err != nil {
+		return err
+	}
+	mc.writeEntry(entry) // Caching is best effort
+	return nil
+}
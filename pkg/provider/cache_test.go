@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// manifestServer serves a manifest with an ETag, responding with status
+// instead once status is non-zero. It counts the requests received and those
+// revalidated as unmodified.
+type manifestServer struct {
+	URL         string
+	status      int32
+	requests    int32
+	revalidated int32
+}
+
+func newManifestServer(t *testing.T, body string) *manifestServer {
+	t.Helper()
+	ms := new(manifestServer)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ms.requests, 1)
+		if status := atomic.LoadInt32(&ms.status); status != 0 {
+			w.WriteHeader(int(status))
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&ms.revalidated, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	ms.URL = srv.URL + "/manifest.json"
+	return ms
+}
+
+func (ms *manifestServer) setStatus(status int) {
+	atomic.StoreInt32(&ms.status, int32(status))
+}
+
+// getManifest gets the manifest at a URL through a cache, returning its
+// version.
+func getManifest(ctx context.Context, mc *ManifestCache, rawurl string) (string, error) {
+	var manifest struct {
+		Version string `json:"version"`
+	}
+	err := mc.getJSON(ctx, rawurl, &manifest)
+	return manifest.Version, err
+}
+
+func TestManifestCache(t *testing.T) {
+	ctx := context.Background()
+	ms := newManifestServer(t, `{"version": "1.16.5"}`)
+	mc := &ManifestCache{Dir: tempDir(t), TTL: time.Hour}
+
+	if got, err := getManifest(ctx, mc, ms.URL); err != nil || got != "1.16.5" {
+		t.Fatalf("get = %q, %v; want %q, nil", got, err, "1.16.5")
+	}
+	if got, err := getManifest(ctx, mc, ms.URL); err != nil || got != "1.16.5" || ms.requests != 1 {
+		t.Errorf("get within TTL = %q, %v after %d requests; want %q, nil after 1 request", got, err, ms.requests, "1.16.5")
+	}
+
+	// Expired manifests are revalidated
+	mc.TTL = 0
+	if got, err := getManifest(ctx, mc, ms.URL); err != nil || got != "1.16.5" || ms.revalidated != 1 {
+		t.Errorf("get after TTL = %q, %v after %d revalidations; want %q, nil after 1 revalidation", got, err, ms.revalidated, "1.16.5")
+	}
+
+	// Refreshed manifests are requested unconditionally
+	mc.Refresh = true
+	if got, err := getManifest(ctx, mc, ms.URL); err != nil || got != "1.16.5" || ms.requests != 3 || ms.revalidated != 1 {
+		t.Errorf("get with refresh = %q, %v after %d requests; want %q, nil after 3 requests", got, err, ms.requests, "1.16.5")
+	}
+
+	// Offline contexts use cached manifests regardless of their age
+	if got, err := getManifest(WithOffline(ctx), mc, ms.URL); err != nil || got != "1.16.5" || ms.requests != 3 {
+		t.Errorf("get offline = %q, %v after %d requests; want %q, nil after 3 requests", got, err, ms.requests, "1.16.5")
+	}
+	if _, err := getManifest(WithOffline(ctx), mc, ms.URL+"?uncached"); !errors.Is(err, ErrOffline) {
+		t.Errorf("get uncached offline error = %v, want %v", err, ErrOffline)
+	}
+}
+
+func TestManifestCacheServerError(t *testing.T) {
+	ctx := context.Background()
+	ms := newManifestServer(t, `{"version": "1.16.5"}`)
+	mc := &ManifestCache{Dir: tempDir(t)}
+	ms.setStatus(http.StatusServiceUnavailable)
+
+	if _, err := getManifest(ctx, mc, ms.URL); err == nil {
+		t.Error("get of uncached manifest succeeded")
+	}
+
+	// Stale manifests are used while the server responds with errors
+	ms.setStatus(0)
+	if _, err := getManifest(ctx, mc, ms.URL); err != nil {
+		t.Fatalf("get error = %v", err)
+	}
+	ms.setStatus(http.StatusServiceUnavailable)
+	if got, err := getManifest(ctx, mc, ms.URL); err != nil || got != "1.16.5" {
+		t.Errorf("get = %q, %v; want %q, nil", got, err, "1.16.5")
+	}
+	mc.Refresh = true
+	if got, err := getManifest(ctx, mc, ms.URL); err != nil || got != "1.16.5" {
+		t.Errorf("get with refresh = %q, %v; want %q, nil", got, err, "1.16.5")
+	}
+}
@@ -0,0 +1,432 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/url"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// CustomProvider is a provider for server software described by a declarative
+// descriptor, allowing editions to be added without modifying MCL.
+type CustomProvider struct {
+	// Logger receives the output of the prepare command while preparing
+	// servers. If nil, prepare command output is discarded.
+	Logger *zap.Logger
+
+	descriptor CustomDescriptor
+	runTmpl    []*template.Template
+	prepTmpl   []*template.Template
+}
+
+// CustomDescriptor describes the editions, versions, and commands of a
+// CustomProvider. Descriptors may be written in either JSON or YAML.
+type CustomDescriptor struct {
+	// Edition is the unique edition ID.
+	Edition string `json:"edition" yaml:"edition"`
+
+	// Name is the full name of the edition. If empty, the edition ID is used.
+	Name string `json:"name" yaml:"name"`
+
+	// DefaultVersion is the default version identifier, which must be a
+	// declared version or alias. If empty, the "latest" alias is used if
+	// declared, or otherwise the last declared version.
+	DefaultVersion string `json:"defaultVersion" yaml:"defaultVersion"`
+
+	// Aliases maps version aliases (e.g. latest or stable) to versions.
+	Aliases map[string]string `json:"aliases" yaml:"aliases"`
+
+	// Versions lists all available versions and their server resources.
+	Versions []CustomVersion `json:"versions" yaml:"versions"`
+
+	// Prepare is an optional command template run from the base directory to
+	// prepare fetched server resources. It may not include {{.RuntimeArgs}},
+	// {{.ServerArgs}}, or {{.WorkingDir}}, as servers are prepared independently
+	// of where they run.
+	Prepare []string `json:"prepare" yaml:"prepare"`
+
+	// Run is the command template used to run the server from the working
+	// directory. Arguments that are exactly {{.RuntimeArgs}} or {{.ServerArgs}}
+	// expand to the runtime or server arguments; neither may appear within
+	// another argument.
+	Run []string `json:"run" yaml:"run"`
+
+	// StopCommand is the console command written to the server's stdin to stop
+	// it gracefully. If empty, "stop" is used.
+	StopCommand string `json:"stopCommand" yaml:"stopCommand"`
+}
+
+// CustomVersion describes a version of a CustomDescriptor and its server
+// resource.
+type CustomVersion struct {
+	// Version is the fixed version identifier.
+	Version string `json:"version" yaml:"version"`
+
+	// URL is the URL of the server resource.
+	URL string `json:"url" yaml:"url"`
+
+	// Filename is the name of the server resource within the base directory. If
+	// empty, the last element of the URL path is used.
+	Filename string `json:"filename" yaml:"filename"`
+
+	// SHA1 and SHA256 are optional hex-encoded checksums of the server
+	// resource. If both are empty, the resource is not verified.
+	SHA1   string `json:"sha1" yaml:"sha1"`
+	SHA256 string `json:"sha256" yaml:"sha256"`
+}
+
+// customCommandData contains the fields available to command templates.
+type customCommandData struct {
+	BaseDir    string // Absolute path of the base directory
+	WorkingDir string // Absolute path of the working directory; only for run
+	Version    string // Fixed version identifier
+	File       string // Absolute path of the server resource
+}
+
+const (
+	// Command template arguments that expand to zero or more runtime or server
+	// arguments
+	customRuntimeArgsArg string = "{{.RuntimeArgs}}"
+	customServerArgsArg  string = "{{.ServerArgs}}"
+)
+
+// LoadCustomProvider loads a descriptor from a JSON (.json) or YAML (.yaml or
+// .yml) file and creates a new CustomProvider from it.
+func LoadCustomProvider(filename string) (*CustomProvider, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var descriptor CustomDescriptor
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&descriptor)
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(b, &descriptor)
+	default:
+		return nil, errors.New("unsupported descriptor format " + filepath.Ext(filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewCustomProvider(descriptor)
+}
+
+// NewCustomProvider creates a new CustomProvider from a descriptor, returning
+// an error if the descriptor is invalid.
+func NewCustomProvider(descriptor CustomDescriptor) (*CustomProvider, error) {
+	if descriptor.Edition == "" {
+		return nil, errors.New("descriptor has no edition")
+	}
+	if len(descriptor.Run) == 0 {
+		return nil, errors.New("descriptor has no run command")
+	}
+	if len(descriptor.Versions) == 0 {
+		return nil, errors.New("descriptor has no versions")
+	}
+
+	versions := make(map[string]bool)
+	for _, v := range descriptor.Versions {
+		if v.Version == "" || v.URL == "" {
+			return nil, errors.New("descriptor version requires a version and url")
+		}
+		versions[v.Version] = true
+	}
+	for alias, version := range descriptor.Aliases {
+		if !versions[version] {
+			return nil, fmt.Errorf("alias %s references unknown version %s", alias, version)
+		}
+	}
+	if dv := descriptor.DefaultVersion; dv != "" {
+		if _, ok := descriptor.Aliases[dv]; !ok && !versions[dv] {
+			return nil, errors.New("default version references unknown version " + dv)
+		}
+	}
+
+	runTmpl, err := parseCustomCommand(descriptor.Run, true)
+	if err != nil {
+		return nil, fmt.Errorf("run command: %w", err)
+	}
+	prepTmpl, err := parseCustomCommand(descriptor.Prepare, false)
+	if err != nil {
+		return nil, fmt.Errorf("prepare command: %w", err)
+	}
+
+	return &CustomProvider{
+		descriptor: descriptor,
+		runTmpl:    runTmpl,
+		prepTmpl:   prepTmpl,
+	}, nil
+}
+
+// parseCustomCommand parses the templates of each argument of a command.
+// {{.RuntimeArgs}} and {{.ServerArgs}} must be whole arguments, and they and
+// {{.WorkingDir}} are only accepted if run is true. Each template is executed
+// against empty data to ensure that it only references available fields.
+func parseCustomCommand(command []string, run bool) ([]*template.Template, error) {
+	tmpls := make([]*template.Template, len(command))
+	for i, arg := range command {
+		if arg == customRuntimeArgsArg || arg == customServerArgsArg {
+			if !run {
+				return nil, errors.New(arg + " is not supported")
+			}
+			if i == 0 {
+				return nil, errors.New(arg + " cannot be the executable")
+			}
+			continue // Expanded separately
+		}
+		if strings.Contains(arg, ".RuntimeArgs") || strings.Contains(arg, ".ServerArgs") {
+			return nil, fmt.Errorf("argument %q: %s and %s must be whole arguments", arg, customRuntimeArgsArg, customServerArgsArg)
+		}
+		if !run && strings.Contains(arg, ".WorkingDir") {
+			return nil, fmt.Errorf("argument %q: {{.WorkingDir}} is not supported", arg)
+		}
+		tmpl, err := template.New("arg").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		if err := tmpl.Execute(ioutil.Discard, customCommandData{}); err != nil {
+			return nil, err
+		}
+		tmpls[i] = tmpl
+	}
+	return tmpls, nil
+}
+
+// expandCommand executes each template of a command. Arguments that are
+// exactly {{.RuntimeArgs}} or {{.ServerArgs}} expand to the respective
+// arguments.
+func (cp *CustomProvider) expandCommand(command []string, tmpls []*template.Template, data customCommandData, runtimeArgs, serverArgs []string) ([]string, error) {
+	args := make([]string, 0, len(command)+len(runtimeArgs)+len(serverArgs))
+	for i, arg := range command {
+		switch arg {
+		case customRuntimeArgsArg:
+			args = append(args, runtimeArgs...)
+		case customServerArgsArg:
+			args = append(args, serverArgs...)
+		default:
+			var sb strings.Builder
+			if err := tmpls[i].Execute(&sb, data); err != nil {
+				return nil, err
+			}
+			args = append(args, sb.String())
+		}
+	}
+	if len(args) == 0 {
+		return nil, errors.New("command expanded to no arguments")
+	}
+	return args, nil
+}
+
+func (cp *CustomProvider) lookupVersion(version string) (*CustomVersion, error) {
+	if v, ok := cp.descriptor.Aliases[version]; ok {
+		version = v
+	}
+	for i, v := range cp.descriptor.Versions {
+		if v.Version == version {
+			return &cp.descriptor.Versions[i], nil
+		}
+	}
+	return nil, errors.New("version not found")
+}
+
+func (cp *CustomProvider) commandData(baseDir, version string) (customCommandData, error) {
+	cv, err := cp.lookupVersion(version)
+	if err != nil {
+		return customCommandData{}, err
+	}
+	absBaseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return customCommandData{}, err
+	}
+	return customCommandData{
+		BaseDir: absBaseDir,
+		Version: cv.Version,
+		File:    cp.filePath(absBaseDir, cv),
+	}, nil
+}
+
+// verification returns the hash and hex-encoded checksum by which to verify the
+// server resource of a version, preferring SHA-256. It returns a nil hash if the
+// descriptor declares no checksum.
+func (CustomProvider) verification(cv *CustomVersion) (hash.Hash, string) {
+	switch {
+	case cv.SHA256 != "":
+		return sha256.New(), cv.SHA256
+	case cv.SHA1 != "":
+		return sha1.New(), cv.SHA1
+	default:
+		return nil, ""
+	}
+}
+
+func (CustomProvider) filePath(baseDir string, cv *CustomVersion) string {
+	filename := cv.Filename
+	if filename == "" {
+		if u, err := url.Parse(cv.URL); err == nil {
+			filename = path.Base(u.Path)
+		}
+	}
+	return filepath.Join(baseDir, filepath.Base(filename))
+}
+
+// Edition returns the edition ID and name declared by the descriptor.
+func (cp *CustomProvider) Edition() (id string, name string) {
+	if cp.descriptor.Name == "" {
+		return cp.descriptor.Edition, cp.descriptor.Edition
+	}
+	return cp.descriptor.Edition, cp.descriptor.Name
+}
+
+// Versions returns all versions declared by the descriptor.
+func (cp *CustomProvider) Versions(_ context.Context) ([]string, error) {
+	versionIDs := make([]string, 0, len(cp.descriptor.Versions))
+	for _, v := range cp.descriptor.Versions {
+		versionIDs = append(versionIDs, v.Version)
+	}
+	return versionIDs, nil
+}
+
+// DefaultVersion returns the default version declared by the descriptor. If
+// none is declared, it returns "latest" if the descriptor declares such an
+// alias, or otherwise the last declared version.
+func (cp *CustomProvider) DefaultVersion() string {
+	if cp.descriptor.DefaultVersion != "" {
+		return cp.descriptor.DefaultVersion
+	}
+	if _, ok := cp.descriptor.Aliases["latest"]; ok {
+		return "latest"
+	}
+	return cp.descriptor.Versions[len(cp.descriptor.Versions)-1].Version
+}
+
+// ResolveVersion resolves a version identifier to a fixed version identifier
+// using the aliases declared by the descriptor.
+func (cp *CustomProvider) ResolveVersion(_ context.Context, version string) (string, error) {
+	cv, err := cp.lookupVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return cv.Version, nil
+}
+
+// IsFetchNeeded returns whether the server resources for the edition and a
+// specified version are not available locally and require fetching. For custom
+// providers, it checks if the server resource exists locally, and if so,
+// compares its checksum with that declared by the descriptor if available.
+func (cp *CustomProvider) IsFetchNeeded(_ context.Context, baseDir, version string) (bool, error) {
+	cv, err := cp.lookupVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	h, expected := cp.verification(cv)
+	if h == nil {
+		exists, err := fileExists(cp.filePath(baseDir, cv))
+		return !exists, err
+	}
+	ok, err := fileHashMatches(cp.filePath(baseDir, cv), h, expected)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+// Fetch fetches (downloads) server resources into a specified base directory.
+// For custom providers, it downloads the server resource declared for the
+// version, verifying it against the checksum declared by the descriptor if
+// available. Any previous preparation is invalidated.
+func (cp *CustomProvider) Fetch(ctx context.Context, baseDir, version string) error {
+	cv, err := cp.lookupVersion(version)
+	if err != nil {
+		return err
+	}
+
+	if err := unmarkPrepared(baseDir); err != nil {
+		return err
+	}
+	h, expected := cp.verification(cv)
+	return downloadVerifiedFile(ctx, cv.URL, cp.filePath(baseDir, cv), h, expected, 0)
+}
+
+// IsPrepareNeeded returns whether the server resources for the edition and a
+// specified version are not available for immediate use and required
+// additional preparation. For custom providers, it checks whether the prepare
+// command, if declared, previously completed successfully.
+func (cp *CustomProvider) IsPrepareNeeded(_ context.Context, baseDir, _ string) (bool, error) {
+	if len(cp.descriptor.Prepare) == 0 {
+		return false, nil
+	}
+	prepared, err := isPrepared(baseDir)
+	return !prepared, err
+}
+
+// Prepare prepares (preprocesses) fetched server resources such that they are
+// immediately useable without any further modifications. For custom providers,
+// it runs the prepare command, if declared, from the base directory, logging
+// its output.
+func (cp *CustomProvider) Prepare(ctx context.Context, baseDir, version string) error {
+	if len(cp.descriptor.Prepare) == 0 {
+		return nil
+	}
+
+	data, err := cp.commandData(baseDir, version)
+	if err != nil {
+		return err
+	}
+	args, err := cp.expandCommand(cp.descriptor.Prepare, cp.prepTmpl, data, nil, nil)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = data.BaseDir
+	pt := newProgressTracker(ctx, filepath.Base(args[0]), 0)
+	if err := runLogged(cmd, cp.Logger, pt); err != nil {
+		return err
+	}
+	return markPrepared(baseDir)
+}
+
+// Run runs a server within a specified working directory. Server resources
+// should have been previously fetched and prepared to the same base directory
+// and for the same version prior to calling Run. Runtime and server arguments
+// are expanded where the run command declares {{.RuntimeArgs}} and
+// {{.ServerArgs}}, and are otherwise ignored.
+func (cp *CustomProvider) Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error {
+	data, err := cp.commandData(baseDir, version)
+	if err != nil {
+		return err
+	}
+	if data.WorkingDir, err = filepath.Abs(workingDir); err != nil {
+		return err
+	}
+	args, err := cp.expandCommand(cp.descriptor.Run, cp.runTmpl, data, runtimeArgs, serverArgs)
+	if err != nil {
+		return err
+	}
+
+	stopCommand := cp.descriptor.StopCommand
+	if stopCommand == "" {
+		stopCommand = serverStopCommand
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = workingDir
+	return runAttached(ctx, cmd, stopCommand)
+}
@@ -0,0 +1,286 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"text/template"
+)
+
+const customTestDescriptor = `
+edition: example
+name: Example Server
+aliases:
+  latest: "1.1"
+versions:
+  - version: "1.0"
+    url: https://example.com/files/server-1.0.jar
+  - version: "1.1"
+    url: https://example.com/download?version=1.1
+    filename: server.jar
+    sha256: 0000000000000000000000000000000000000000000000000000000000000000
+prepare: [java, -jar, "{{.File}}", --install, "{{.BaseDir}}"]
+run: [java, "{{.RuntimeArgs}}", -jar, "{{.BaseDir}}/server-{{.Version}}.jar", --world, "{{.WorkingDir}}/world", "{{.ServerArgs}}"]
+stopCommand: end
+`
+
+func TestLoadCustomProvider(t *testing.T) {
+	tests := []struct {
+		filename string
+		content  string
+		wantErr  bool
+	}{
+		{filename: "example.yaml", content: customTestDescriptor},
+		{filename: "example.yml", content: customTestDescriptor},
+		{filename: "example.json", content: `{"edition": "example", "versions": [{"version": "1.0", "url": "https://example.com/server.jar"}], "run": ["server"]}`},
+		{filename: "example.yaml", content: customTestDescriptor + "unknown: true\n", wantErr: true},
+		{filename: "example.json", content: `{"edition": "example", "unknown": true}`, wantErr: true},
+		{filename: "example.toml", content: `edition = "example"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(tempDir(t), tt.filename)
+		if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cp, err := LoadCustomProvider(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("LoadCustomProvider(%q) error = %v, wantErr %v", tt.filename, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if id, _ := cp.Edition(); id != "example" {
+			t.Errorf("LoadCustomProvider(%q) edition = %q, want %q", tt.filename, id, "example")
+		}
+	}
+}
+
+func TestNewCustomProvider(t *testing.T) {
+	valid := func() CustomDescriptor {
+		return CustomDescriptor{
+			Edition:  "example",
+			Aliases:  map[string]string{"stable": "1.0"},
+			Versions: []CustomVersion{{Version: "1.0", URL: "https://example.com/server.jar"}},
+			Prepare:  []string{"sh", "install.sh", "{{.File}}"},
+			Run:      []string{"java", "{{.RuntimeArgs}}", "-jar", "{{.File}}", "{{.ServerArgs}}"},
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(d *CustomDescriptor)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(d *CustomDescriptor) {}},
+		{name: "no edition", modify: func(d *CustomDescriptor) { d.Edition = "" }, wantErr: true},
+		{name: "no run command", modify: func(d *CustomDescriptor) { d.Run = nil }, wantErr: true},
+		{name: "no versions", modify: func(d *CustomDescriptor) { d.Versions = nil }, wantErr: true},
+		{name: "version without URL", modify: func(d *CustomDescriptor) { d.Versions[0].URL = "" }, wantErr: true},
+		{name: "alias of unknown version", modify: func(d *CustomDescriptor) { d.Aliases["latest"] = "2.0" }, wantErr: true},
+		{name: "default alias", modify: func(d *CustomDescriptor) { d.DefaultVersion = "stable" }},
+		{name: "unknown default version", modify: func(d *CustomDescriptor) { d.DefaultVersion = "2.0" }, wantErr: true},
+		{name: "unknown field", modify: func(d *CustomDescriptor) { d.Run[3] = "{{.Path}}" }, wantErr: true},
+		{name: "invalid template", modify: func(d *CustomDescriptor) { d.Run[3] = "{{.File" }, wantErr: true},
+		{name: "partial server args", modify: func(d *CustomDescriptor) { d.Run[4] = "nogui{{.ServerArgs}}" }, wantErr: true},
+		{name: "runtime args as executable", modify: func(d *CustomDescriptor) { d.Run[0] = "{{.RuntimeArgs}}" }, wantErr: true},
+		{name: "working directory in run", modify: func(d *CustomDescriptor) { d.Run[3] = "{{.WorkingDir}}/server.jar" }},
+		{name: "working directory in prepare", modify: func(d *CustomDescriptor) { d.Prepare[2] = "{{.WorkingDir}}" }, wantErr: true},
+		{name: "server args in prepare", modify: func(d *CustomDescriptor) { d.Prepare[2] = "{{.ServerArgs}}" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		d := valid()
+		tt.modify(&d)
+		if _, err := NewCustomProvider(d); (err != nil) != tt.wantErr {
+			t.Errorf("%s: NewCustomProvider error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCustomExpandCommand(t *testing.T) {
+	path := filepath.Join(tempDir(t), "example.yaml")
+	if err := ioutil.WriteFile(path, []byte(customTestDescriptor), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := LoadCustomProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cp.DefaultVersion(); got != "latest" {
+		t.Errorf("DefaultVersion() = %q, want %q", got, "latest")
+	}
+	version, err := cp.ResolveVersion(context.Background(), "latest")
+	if err != nil || version != "1.1" {
+		t.Fatalf("ResolveVersion(%q) = %q, %v; want %q, nil", "latest", version, err, "1.1")
+	}
+
+	baseDir := tempDir(t)
+	data, err := cp.commandData(baseDir, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.WorkingDir = "/srv/minecraft"
+	tests := []struct {
+		name        string
+		command     []string
+		tmpls       []*template.Template
+		runtimeArgs []string
+		serverArgs  []string
+		want        []string
+	}{
+		{
+			name:        "run",
+			command:     cp.descriptor.Run,
+			tmpls:       cp.runTmpl,
+			runtimeArgs: []string{"-Xmx2G", "-Xms1G"},
+			serverArgs:  []string{"nogui"},
+			want:        []string{"java", "-Xmx2G", "-Xms1G", "-jar", baseDir + "/server-1.1.jar", "--world", "/srv/minecraft/world", "nogui"},
+		},
+		{
+			name:    "run without arguments",
+			command: cp.descriptor.Run,
+			tmpls:   cp.runTmpl,
+			want:    []string{"java", "-jar", baseDir + "/server-1.1.jar", "--world", "/srv/minecraft/world"},
+		},
+		{
+			name:    "prepare",
+			command: cp.descriptor.Prepare,
+			tmpls:   cp.prepTmpl,
+			want:    []string{"java", "-jar", filepath.Join(baseDir, "server.jar"), "--install", baseDir},
+		},
+	}
+	for _, tt := range tests {
+		got, err := cp.expandCommand(tt.command, tt.tmpls, data, tt.runtimeArgs, tt.serverArgs)
+		if err != nil {
+			t.Errorf("%s: expandCommand error = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expandCommand = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// The filename defaults to the last element of the URL path
+	cv, err := cp.lookupVersion("1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cp.filePath(baseDir, cv), filepath.Join(baseDir, "server-1.0.jar"); got != want {
+		t.Errorf("filePath(%q) = %q, want %q", cv.URL, got, want)
+	}
+}
+
+func TestCustomFetch(t *testing.T) {
+	const body = "server"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	sha1Sum := sha1.Sum([]byte(body))
+	sha256Sum := sha256.Sum256([]byte(body))
+	tamperedSum := sha256.Sum256([]byte("tampered"))
+	tests := []struct {
+		name    string
+		sha1    string
+		sha256  string
+		wantErr bool
+	}{
+		{name: "no checksum"},
+		{name: "matching SHA-1", sha1: hex.EncodeToString(sha1Sum[:])},
+		{name: "matching SHA-256", sha256: hex.EncodeToString(sha256Sum[:])},
+		{name: "mismatched SHA-256", sha256: hex.EncodeToString(tamperedSum[:]), wantErr: true},
+		{name: "SHA-256 preferred", sha1: hex.EncodeToString(sha1Sum[:]), sha256: hex.EncodeToString(tamperedSum[:]), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cp, err := NewCustomProvider(CustomDescriptor{
+				Edition:  "example",
+				Versions: []CustomVersion{{Version: "1.0", URL: srv.URL + "/server.jar", SHA1: tt.sha1, SHA256: tt.sha256}},
+				Run:      []string{"java", "-jar", "{{.File}}"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			baseDir := tempDir(t)
+			err = cp.Fetch(ctx, baseDir, "1.0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch error = %v, wantErr %v", err, tt.wantErr)
+			}
+			needed, err := cp.IsFetchNeeded(ctx, baseDir, "1.0")
+			if err != nil || needed != tt.wantErr {
+				t.Errorf("IsFetchNeeded after Fetch = %v, %v; want %v, nil", needed, err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(baseDir, "server.jar")); tt.wantErr && !os.IsNotExist(err) {
+				t.Errorf("server resource with mismatched checksum kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestCustomPrepare(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("prepare command requires a POSIX shell")
+	}
+	tests := []struct {
+		name    string
+		script  string
+		wantErr bool
+	}{
+		{name: "success", script: `pwd > prepared && cat "$1" >> prepared`},
+		{name: "failure", script: `exit 1`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cp, err := NewCustomProvider(CustomDescriptor{
+				Edition:  "example",
+				Versions: []CustomVersion{{Version: "1.0", URL: "https://example.com/server.jar"}},
+				Prepare:  []string{"sh", "-c", tt.script, "sh", "{{.File}}"},
+				Run:      []string{"java", "-jar", "{{.File}}"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			baseDir := tempDir(t)
+			if err := ioutil.WriteFile(filepath.Join(baseDir, "server.jar"), []byte("server\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if needed, err := cp.IsPrepareNeeded(ctx, baseDir, "1.0"); err != nil || !needed {
+				t.Fatalf("IsPrepareNeeded before Prepare = %v, %v; want true, nil", needed, err)
+			}
+			err = cp.Prepare(ctx, baseDir, "1.0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Prepare error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if needed, err := cp.IsPrepareNeeded(ctx, baseDir, "1.0"); err != nil || needed != tt.wantErr {
+				t.Errorf("IsPrepareNeeded after Prepare = %v, %v; want %v, nil", needed, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// The prepare command runs from the base directory
+			b, err := ioutil.ReadFile(filepath.Join(baseDir, "prepared"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			realBaseDir, _ := filepath.EvalSymlinks(baseDir)
+			if got, want := string(b), realBaseDir+"\nserver\n"; got != want {
+				t.Errorf("prepare command output = %q, want %q", got, want)
+			}
+		})
+	}
+}
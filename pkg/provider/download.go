@@ -0,0 +1,375 @@
+package provider
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Maximum number of attempts to download a resource
+	downloadMaxAttempts int = 5
+
+	// Delay before the first retry of a download, which is doubled for each
+	// subsequent retry up to the maximum delay
+	downloadMinRetryDelay time.Duration = time.Second
+	downloadMaxRetryDelay time.Duration = 30 * time.Second
+
+	// Maximum delay requested by a server through Retry-After that is honoured;
+	// downloads fail immediately if a server requests a longer delay
+	downloadMaxRetryAfter time.Duration = 5 * time.Minute
+
+	// Suffix of partially downloaded files, which are resumed by later downloads
+	partialDownloadSuffix string = ".part"
+)
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// downloadError is an error encountered while downloading a resource, which
+// may be transient.
+type downloadError struct {
+	err        error
+	retryable  bool
+	retryAfter time.Duration // Delay requested by the server, if any
+}
+
+func (de *downloadError) Error() string {
+	return de.err.Error()
+}
+
+func (de *downloadError) Unwrap() error {
+	return de.err
+}
+
+// downloadFile downloads the resource at a URL to a file, creating any parent
+// directories and replacing the file if it already exists. The file is only
+// replaced once the download completes.
+func downloadFile(ctx context.Context, rawurl, path string) error {
+	return downloadVerifiedFile(ctx, rawurl, path, nil, "", 0)
+}
+
+// downloadVerifiedFile downloads the resource at a URL to a file as
+// downloadFile does, verifying its size and checksum as it is downloaded. If h
+// is nil, the checksum is not verified, and if size is zero or negative, the
+// size is not verified.
+//
+// The resource is downloaded to a partial file alongside the file, which is
+// only renamed into place once verified; otherwise the file is left
+// unmodified. Transient failures are retried with exponential backoff, and
+// each retry resumes from the end of the partial file using a Range request.
+// If the download is verified by checksum, partial files left by failed or
+// cancelled downloads are likewise resumed by later downloads to the same file;
+// otherwise they are discarded, as the resource may have since changed. The
+// progress of the download is reported to the progress observer of the
+// context, if any.
+//
+// If the context has a blob store and the checksum is SHA-1 or SHA-256, the
+// resource is instead downloaded into the blob store, unless already present,
+// and linked to the file.
+func downloadVerifiedFile(ctx context.Context, rawurl, path string, h hash.Hash, expectedHex string, size int64) error {
+	if ok, err := downloadBlob(ctx, rawurl, path, h, expectedHex, size); ok {
+		return err
+	}
+	return downloadFileTo(ctx, rawurl, path, h, expectedHex, size)
+}
+
+// downloadFileTo downloads the resource at a URL to a file as
+// downloadVerifiedFile does, without using the blob store of the context.
+func downloadFileTo(ctx context.Context, rawurl, path string, h hash.Hash, expectedHex string, size int64) error {
+	if IsOffline(ctx) {
+		return offlineError(rawurl)
+	}
+
+	dir, filename := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, os.ModeDir|0755); err != nil {
+		return err
+	}
+	partPath := filepath.Join(dir, "."+filename+partialDownloadSuffix)
+	flag := os.O_RDWR | os.O_CREATE
+	if h == nil {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(partPath, flag, 0644)
+	if err != nil {
+		return err
+	}
+
+	pt := newProgressTracker(ctx, filename, size)
+	n, err := downloadWithRetry(ctx, rawurl, f, h, pt)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// A partial file that fails verification cannot be resumed, so it is
+		// discarded to restart the next download. Otherwise, the partial file is
+		// retained to resume later.
+		if err = verifyDownload(rawurl, n, h, expectedHex, size); err != nil {
+			os.Remove(partPath)
+		} else {
+			err = os.Rename(partPath, path)
+		}
+	}
+	pt.finish(err)
+	return err
+}
+
+// verifyDownload returns an error if the size or checksum of a downloaded
+// resource do not match the expected size or checksum, if any.
+func verifyDownload(rawurl string, n int64, h hash.Hash, expectedHex string, size int64) error {
+	if size > 0 && n != size {
+		return fmt.Errorf("downloaded %d bytes from %s; expected %d bytes", n, rawurl, size)
+	}
+	if h != nil {
+		if actualHex := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actualHex, expectedHex) {
+			return fmt.Errorf("checksum %s of %s does not match expected %s", actualHex, rawurl, expectedHex)
+		}
+	}
+	return nil
+}
+
+// downloadWithRetry downloads the resource at a URL into a file using
+// downloadPart, retrying transient failures until the maximum number of
+// attempts. It returns the size of the downloaded file.
+func downloadWithRetry(ctx context.Context, rawurl string, f *os.File, h hash.Hash, pt *progressTracker) (int64, error) {
+	var validator string
+	for attempt := 1; ; attempt++ {
+		n, err := downloadPart(ctx, rawurl, f, h, &validator, pt)
+		if err == nil {
+			return n, nil
+		}
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+
+		var de *downloadError
+		if !errors.As(err, &de) || !de.retryable || attempt >= downloadMaxAttempts {
+			return n, err
+		}
+		delay := de.retryAfter
+		if delay == 0 {
+			delay = retryDelay(attempt)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return n, ctx.Err()
+		}
+	}
+}
+
+// retryDelay returns the delay before retrying a download following a number
+// of failed attempts. The delay grows exponentially, and is randomly jittered
+// between half and all of itself so that concurrent downloads do not retry in
+// lockstep.
+func retryDelay(attempt int) time.Duration {
+	delay := downloadMaxRetryDelay
+	if shift := uint(attempt - 1); shift < 32 && downloadMinRetryDelay<<shift < downloadMaxRetryDelay {
+		delay = downloadMinRetryDelay << shift
+	}
+
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return delay/2 + time.Duration(jitterRand.Int63n(int64(delay/2)+1))
+}
+
+// downloadPart downloads the resource at a URL into a file, resuming from the
+// end of the file with a Range request if it is not empty. If h is not nil, it
+// is reset and updated with the entire contents of the file. The validator
+// (i.e. ETag or Last-Modified) of the resource is recorded by the first
+// response, and thereafter ensures that the resource is unchanged when resumed.
+// Progress is added to a progress tracker, which may be nil. downloadPart
+// returns the resulting size of the file.
+func downloadPart(ctx context.Context, rawurl string, f *os.File, h hash.Hash, validator *string, pt *progressTracker) (int64, error) {
+	// Hash the existing contents of the file, which are resumed
+	var hw io.Writer = ioutil.Discard
+	if h != nil {
+		h.Reset()
+		hw = h
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	offset, err := io.Copy(hw, f)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+	if err != nil {
+		return offset, err
+	}
+	req = req.WithContext(ctx)
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		if *validator != "" {
+			req.Header.Set("If-Range", *validator)
+		}
+	}
+	res, err := doRequest(req)
+	if err != nil {
+		return offset, &downloadError{err: err, retryable: true}
+	}
+	defer res.Body.Close()
+
+	total := res.ContentLength
+	switch res.StatusCode {
+	case http.StatusOK:
+		// The server ignored the range, so restart from the beginning
+		if offset > 0 {
+			if offset, err = resetPart(f, h); err != nil {
+				return offset, err
+			}
+		}
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(res.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			if offset, err = resetPart(f, h); err != nil {
+				return offset, err
+			}
+			return offset, &downloadError{
+				err:       fmt.Errorf("unexpected content range from %s", rawurl),
+				retryable: true,
+			}
+		}
+		total = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The file is already complete if a previous attempt failed after
+		// receiving the entire resource; otherwise the resource has changed.
+		if _, size, ok := parseContentRange(res.Header.Get("Content-Range")); ok && size == offset {
+			return offset, nil
+		}
+		if offset, err = resetPart(f, h); err != nil {
+			return offset, err
+		}
+		return offset, &downloadError{
+			err:       fmt.Errorf("unexpected response %q from %s", res.Status, rawurl),
+			retryable: true,
+		}
+	default:
+		retryAfter := parseRetryAfter(res.Header.Get("Retry-After"))
+		return offset, &downloadError{
+			err:        fmt.Errorf("unexpected response %q from %s", res.Status, rawurl),
+			retryable:  isRetryableStatus(res.StatusCode) && retryAfter <= downloadMaxRetryAfter,
+			retryAfter: retryAfter,
+		}
+	}
+
+	// Only strong ETags are valid for If-Range
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		*validator = etag
+	} else if lastModified := res.Header.Get("Last-Modified"); lastModified != "" {
+		*validator = lastModified
+	}
+
+	var w io.Writer = f
+	if h != nil {
+		w = io.MultiWriter(f, h)
+	}
+	pt.set(offset, total)
+	n, err := io.Copy(w, progressReader{r: res.Body, pt: pt})
+	if _, ok := err.(*os.PathError); ok {
+		return offset + n, err // Failed to write to the file
+	} else if err != nil {
+		return offset + n, &downloadError{err: err, retryable: true}
+	}
+	return offset + n, nil
+}
+
+// resetPart truncates a partially downloaded file and resets its hash, if any,
+// so that the download restarts from the beginning.
+func resetPart(f *os.File, h hash.Hash) (int64, error) {
+	if h != nil {
+		h.Reset()
+	}
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return 0, err
+}
+
+// isRetryableStatus returns whether an HTTP status code indicates a transient
+// failure.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date. It returns zero if the value is empty or
+// invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(t); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// parseContentRange parses the value of a Content-Range header of the form
+// "bytes <start>-<end>/<size>" or "bytes */<size>", returning the start and
+// complete size of the resource. The start is -1 if unspecified, as is the size
+// if unknown.
+func parseContentRange(value string) (start, size int64, ok bool) {
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	value = strings.TrimPrefix(value, "bytes ")
+	i := strings.IndexByte(value, '/')
+	if i < 0 {
+		return 0, 0, false
+	}
+	rangeSpec, sizeSpec := value[:i], value[i+1:]
+
+	var err error
+	start, size = -1, -1
+	if rangeSpec != "*" {
+		j := strings.IndexByte(rangeSpec, '-')
+		if j < 0 {
+			return 0, 0, false
+		}
+		if start, err = strconv.ParseInt(rangeSpec[:j], 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if sizeSpec != "*" {
+		if size, err = strconv.ParseInt(sizeSpec, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, size, true
+}
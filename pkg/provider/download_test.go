@@ -0,0 +1,238 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// downloadServer serves a resource using handlers for successive requests, the
+// last of which handles any further requests. It records the headers of each
+// request received.
+type downloadServer struct {
+	URL string
+
+	mu       sync.Mutex
+	handlers []http.HandlerFunc
+	requests []http.Header
+}
+
+func newDownloadServer(t *testing.T, handlers ...http.HandlerFunc) *downloadServer {
+	t.Helper()
+	ds := &downloadServer{handlers: handlers}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ds.mu.Lock()
+		handler := ds.handlers[0]
+		if len(ds.handlers) > 1 {
+			ds.handlers = ds.handlers[1:]
+		}
+		ds.requests = append(ds.requests, r.Header.Clone())
+		ds.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	ds.URL = srv.URL + "/server.jar"
+	return ds
+}
+
+// received returns the headers of the requests received.
+func (ds *downloadServer) received() []http.Header {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return append([]http.Header(nil), ds.requests...)
+}
+
+// serveResource serves a resource with an ETag, honouring Range and If-Range
+// headers.
+func serveResource(etag string, content []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "server.jar", time.Time{}, bytes.NewReader(content))
+	}
+}
+
+// disconnectAfter serves the first n bytes of a resource with an ETag, and then
+// disconnects before the rest of the resource is sent.
+func disconnectAfter(etag string, content []byte, n int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content[:n])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// respondStatus responds with a status code and headers given as key-value
+// pairs.
+func respondStatus(code int, header ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// partialPath returns the path of the partial file of a download to path.
+func partialPath(path string) string {
+	dir, filename := filepath.Split(path)
+	return filepath.Join(dir, "."+filename+partialDownloadSuffix)
+}
+
+// checkDownloaded checks that a file was downloaded with the expected content,
+// and that no partial file remains.
+func checkDownloaded(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("downloaded %q, want %q", got, want)
+	}
+	if _, err := os.Stat(partialPath(path)); !os.IsNotExist(err) {
+		t.Errorf("partial file remains after download: %v", err)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	ds := newDownloadServer(t,
+		disconnectAfter(`"v1"`, content, 10),
+		serveResource(`"v1"`, content),
+	)
+	path := filepath.Join(tempDir(t), "server.jar")
+
+	if err := downloadVerifiedFile(context.Background(), ds.URL, path, sha256.New(), sha256Hex(content), int64(len(content))); err != nil {
+		t.Fatalf("download error = %v", err)
+	}
+	checkDownloaded(t, path, content)
+
+	requests := ds.received()
+	if len(requests) != 2 {
+		t.Fatalf("received %d requests, want 2", len(requests))
+	}
+	if got, want := requests[1].Get("Range"), "bytes=10-"; got != want {
+		t.Errorf("Range of resumed request = %q, want %q", got, want)
+	}
+	if got, want := requests[1].Get("If-Range"), `"v1"`; got != want {
+		t.Errorf("If-Range of resumed request = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadResourceChanged(t *testing.T) {
+	oldContent := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	newContent := []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ9876543210")
+	ds := newDownloadServer(t,
+		disconnectAfter(`"v1"`, oldContent, 10),
+		serveResource(`"v2"`, newContent),
+	)
+	path := filepath.Join(tempDir(t), "server.jar")
+
+	// The changed ETag makes the server ignore the range, restarting the
+	// download from the beginning
+	if err := downloadVerifiedFile(context.Background(), ds.URL, path, sha256.New(), sha256Hex(newContent), 0); err != nil {
+		t.Fatalf("download error = %v", err)
+	}
+	checkDownloaded(t, path, newContent)
+
+	requests := ds.received()
+	if len(requests) != 2 {
+		t.Fatalf("received %d requests, want 2", len(requests))
+	}
+	if got, want := requests[1].Get("If-Range"), `"v1"`; got != want {
+		t.Errorf("If-Range of resumed request = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadCompletePart(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	ds := newDownloadServer(t, serveResource(`"v1"`, content))
+	path := filepath.Join(tempDir(t), "server.jar")
+
+	// A partial file left by a download that failed after receiving the entire
+	// resource is completed by the 416 response to its range
+	if err := ioutil.WriteFile(partialPath(path), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloadVerifiedFile(context.Background(), ds.URL, path, sha256.New(), sha256Hex(content), int64(len(content))); err != nil {
+		t.Fatalf("download error = %v", err)
+	}
+	checkDownloaded(t, path, content)
+
+	requests := ds.received()
+	if len(requests) != 1 {
+		t.Fatalf("received %d requests, want 1", len(requests))
+	}
+	if got, want := requests[0].Get("Range"), "bytes=36-"; got != want {
+		t.Errorf("Range = %q, want %q", got, want)
+	}
+}
+
+func TestDownloadRetryAfter(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	ds := newDownloadServer(t,
+		respondStatus(http.StatusServiceUnavailable, "Retry-After", "1"),
+		serveResource(`"v1"`, content),
+	)
+	path := filepath.Join(tempDir(t), "server.jar")
+
+	start := time.Now()
+	if err := downloadFile(context.Background(), ds.URL, path); err != nil {
+		t.Fatalf("download error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least 1s", elapsed)
+	}
+	checkDownloaded(t, path, content)
+	if n := len(ds.received()); n != 2 {
+		t.Errorf("received %d requests, want 2", n)
+	}
+
+	// Longer delays than the maximum fail immediately
+	ds = newDownloadServer(t,
+		respondStatus(http.StatusServiceUnavailable, "Retry-After", strconv.Itoa(int(2*downloadMaxRetryAfter/time.Second))),
+		serveResource(`"v1"`, content),
+	)
+	path = filepath.Join(tempDir(t), "server.jar")
+	if err := downloadFile(context.Background(), ds.URL, path); err == nil {
+		t.Error("download succeeded despite excessive Retry-After")
+	}
+	if n := len(ds.received()); n != 1 {
+		t.Errorf("received %d requests, want 1", n)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file exists after failed download: %v", err)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	ds := newDownloadServer(t, serveResource(`"v1"`, content))
+	path := filepath.Join(tempDir(t), "server.jar")
+
+	if err := downloadVerifiedFile(context.Background(), ds.URL, path, sha256.New(), sha256Hex([]byte("other")), 0); err == nil {
+		t.Fatal("download succeeded despite checksum mismatch")
+	}
+	for _, p := range []string{path, partialPath(path)} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s exists after failed download: %v", filepath.Base(p), err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// runLogged runs a command to completion, logging each line it writes to
+// stdout or stderr to a logger. A nil logger discards the output. The output is
+// also added to a progress tracker, which may be nil, as the progress of the
+// command is otherwise unknown.
+func runLogged(cmd *exec.Cmd, logger *zap.Logger, pt *progressTracker) error {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logLines(progressReader{r: pr, pt: pt}, logger)
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	<-done
+	pt.finish(err)
+	return err
+}
+
+// logLines logs each line read from a reader to a logger until the reader is
+// exhausted.
+func logLines(r io.Reader, logger *zap.Logger) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		logger.Info(s.Text())
+	}
+	io.Copy(ioutil.Discard, r) // Drain lines too long for the scanner
+}
+
+// runAttached runs a server command to completion with all standard pipes
+// attached to those of the run options of the context, which default to those
+// of the current process. Once the context is done, the server is stopped
+// gracefully by sending a stop command to its stdin, through the Send function
+// of the run options if any, and is killed if it does not exit within the stop
+// timeout of the run options or is killed through them. It returns nil if the
+// server exits successfully after being stopped.
+//
+// The server is started in a new process group, such that interrupts from a
+// terminal (e.g. Ctrl-C) are not delivered to the server directly, but only
+// through stopping it gracefully.
+func runAttached(ctx context.Context, cmd *exec.Cmd, stopCommand string) error {
+	opts := runOptions(ctx)
+	setNewProcessGroup(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// The server's stdin remains open after the stdin of the run options is
+	// exhausted so that the stop command may still be written
+	go io.Copy(stdin, opts.Stdin)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	if opts.Send != nil {
+		opts.Send(stopCommand)
+	} else {
+		io.WriteString(stdin, stopCommand+"\n")
+	}
+	timer := time.NewTimer(opts.StopTimeout)
+	defer timer.Stop()
+	killErr := fmt.Errorf("server did not stop within %s and was killed", opts.StopTimeout)
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	case <-opts.Kill:
+		killErr = errors.New("server was killed while stopping")
+	}
+	if err := cmd.Process.Kill(); err != nil {
+		return err
+	}
+	<-done
+	return killErr
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package provider
+
+import "os/exec"
+
+// setNewProcessGroup does nothing, as process groups are not supported on this
+// platform.
+func setNewProcessGroup(_ *exec.Cmd) {}
@@ -0,0 +1,15 @@
+package provider
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setNewProcessGroup sets a command to start in a new process group, which
+// ignores Ctrl-C in the console.
+func setNewProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
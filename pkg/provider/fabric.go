@@ -0,0 +1,364 @@
+package provider
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FabricProvider is a provider for Minecraft: Java Edition servers with the
+// Fabric mod loader.
+type FabricProvider struct {
+	// MetaURL is the base URL of the Fabric meta API. If empty, the official
+	// Fabric meta API is used.
+	MetaURL string
+
+	// AcceptedHostnames restricts the hostnames that the provider may request,
+	// including those of URLs listed by manifests and of redirects, to those
+	// listed and their subdomains (see AnyHostname). The hostname of the meta
+	// API URL is always accepted. If empty, only the hostnames of FabricMC are
+	// accepted. The vanilla server JAR is restricted to the hostnames accepted by
+	// JavaProvider.
+	AcceptedHostnames []string
+
+	// Cache, if non-nil, persistently caches the manifests provided by the
+	// Fabric meta API and the Mojang manifests used to fetch the vanilla server
+	// JAR.
+	Cache *ManifestCache
+
+	// Java, if non-nil, provides the vanilla server JAR (e.g. to share its
+	// mirror). Otherwise, a JavaProvider with default settings and the same
+	// cache provides it.
+	Java *JavaProvider
+
+	java              JavaProvider // Provides the vanilla server JAR by default
+	gameVersions      []fabricVersionInfo
+	loaderVersions    []fabricVersionInfo
+	installerVersions []fabricVersionInfo
+}
+
+type fabricVersionInfo struct {
+	Version string `json:"version"`
+	Stable  bool   `json:"stable"`
+}
+
+// fabricVersion is a parsed version identifier for the Fabric provider. Empty
+// fields are resolved to their defaults.
+type fabricVersion struct {
+	Game      string
+	Loader    string
+	Installer string
+}
+
+const (
+	// Base URL of the meta API provided by Fabric
+	fabricMetaURL string = "https://meta.fabricmc.net/v2"
+
+	// Filename of the Fabric server launcher JAR
+	fabricLauncherJARFilename string = "fabric-server-launch.jar"
+
+	// Prefixes of the loader and installer components of a version identifier
+	fabricLoaderPrefix    string = "loader"
+	fabricInstallerPrefix string = "installer"
+)
+
+// parseFabricVersion parses a version identifier of the form
+// <game>[+loader<loader>][+installer<installer>].
+func parseFabricVersion(version string) (fabricVersion, error) {
+	parts := strings.Split(version, "+")
+	fv := fabricVersion{Game: parts[0]}
+	if fv.Game == "" {
+		return fv, errors.New("missing game version")
+	}
+	for _, part := range parts[1:] {
+		switch {
+		case strings.HasPrefix(part, fabricLoaderPrefix) && fv.Loader == "":
+			fv.Loader = strings.TrimPrefix(part, fabricLoaderPrefix)
+		case strings.HasPrefix(part, fabricInstallerPrefix) && fv.Installer == "":
+			fv.Installer = strings.TrimPrefix(part, fabricInstallerPrefix)
+		default:
+			return fv, errors.New("invalid version component " + part)
+		}
+	}
+	return fv, nil
+}
+
+// String returns the version identifier for the Fabric version.
+func (fv fabricVersion) String() string {
+	var sb strings.Builder
+	sb.WriteString(fv.Game)
+	if fv.Loader != "" {
+		sb.WriteString("+" + fabricLoaderPrefix + fv.Loader)
+	}
+	if fv.Installer != "" {
+		sb.WriteString("+" + fabricInstallerPrefix + fv.Installer)
+	}
+	return sb.String()
+}
+
+// fabricAcceptedHostnames are the hostnames accepted by default for Fabric,
+// which are those used by FabricMC for its meta API and Maven repository.
+var fabricAcceptedHostnames = []string{
+	"fabricmc.net",
+}
+
+func (fp *FabricProvider) restrictHostnames(ctx context.Context) context.Context {
+	if len(fp.AcceptedHostnames) == 0 {
+		return restrictHostnames(ctx, fabricAcceptedHostnames, fp.metaURL())
+	}
+	return restrictHostnames(ctx, fp.AcceptedHostnames, fp.metaURL())
+}
+
+func (fp *FabricProvider) metaURL(elem ...string) string {
+	metaURL := fp.MetaURL
+	if metaURL == "" {
+		metaURL = fabricMetaURL
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(metaURL, "/"))
+	sb.WriteString("/versions")
+	for _, e := range elem {
+		sb.WriteByte('/')
+		sb.WriteString(url.PathEscape(e))
+	}
+	return sb.String()
+}
+
+func (fp *FabricProvider) fetchManifest(ctx context.Context, force bool) error {
+	if force || fp.gameVersions == nil {
+		var gameVersions, loaderVersions, installerVersions []fabricVersionInfo
+		if err := fp.Cache.getJSON(ctx, fp.metaURL("game"), &gameVersions); err != nil {
+			return err
+		}
+		if err := fp.Cache.getJSON(ctx, fp.metaURL("loader"), &loaderVersions); err != nil {
+			return err
+		}
+		if err := fp.Cache.getJSON(ctx, fp.metaURL("installer"), &installerVersions); err != nil {
+			return err
+		}
+		fp.gameVersions = gameVersions
+		fp.loaderVersions = loaderVersions
+		fp.installerVersions = installerVersions
+	}
+
+	return nil
+}
+
+// resolveFabricComponent resolves a component version against versions listed
+// by the Fabric meta API, ordered from newest to oldest. An empty version or
+// "stable" resolves to the newest stable version, and "latest" resolves to the
+// newest version.
+func resolveFabricComponent(versions []fabricVersionInfo, version string) (string, error) {
+	for _, vInfo := range versions {
+		switch {
+		case version == "" || version == "stable":
+			if vInfo.Stable {
+				return vInfo.Version, nil
+			}
+		case version == "latest", version == vInfo.Version:
+			return vInfo.Version, nil
+		}
+	}
+	return "", errors.New("version not found")
+}
+
+func (fp *FabricProvider) resolveVersion(version string) (fabricVersion, error) {
+	fv, err := parseFabricVersion(version)
+	if err != nil {
+		return fv, err
+	}
+
+	if fv.Game, err = resolveFabricComponent(fp.gameVersions, fv.Game); err != nil {
+		return fv, errors.New("game version not found")
+	}
+	if fv.Loader, err = resolveFabricComponent(fp.loaderVersions, fv.Loader); err != nil {
+		return fv, errors.New("loader version not found")
+	}
+	if fv.Installer, err = resolveFabricComponent(fp.installerVersions, fv.Installer); err != nil {
+		return fv, errors.New("installer version not found")
+	}
+	return fv, nil
+}
+
+// vanilla returns the provider of the vanilla server JAR.
+func (fp *FabricProvider) vanilla() *JavaProvider {
+	if fp.Java != nil {
+		return fp.Java
+	}
+	fp.java.Cache = fp.Cache
+	return &fp.java
+}
+
+func (FabricProvider) launcherJARPath(baseDir string) string {
+	return filepath.Join(baseDir, fabricLauncherJARFilename)
+}
+
+// isLauncherValid returns whether the Fabric server launcher JAR in a base
+// directory exists and is a readable JAR. The meta API generates launchers on
+// demand without publishing their checksums, so this only detects incomplete or
+// malformed downloads. It returns false and a nil error if the JAR is missing.
+func (fp *FabricProvider) isLauncherValid(baseDir string) (bool, error) {
+	f, err := os.Open(fp.launcherJARPath(baseDir))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	_, err = zip.NewReader(f, fi.Size())
+	return err == nil, nil
+}
+
+// fetchLauncher downloads the Fabric server launcher JAR for a version to a
+// base directory, removing it if it is not a valid JAR.
+func (fp *FabricProvider) fetchLauncher(ctx context.Context, baseDir string, fv fabricVersion) error {
+	rawurl := fp.metaURL("loader", fv.Game, fv.Loader, fv.Installer, "server", "jar")
+	jarPath := fp.launcherJARPath(baseDir)
+	if err := downloadFile(ctx, rawurl, jarPath); err != nil {
+		return err
+	}
+
+	if ok, err := fp.isLauncherValid(baseDir); err != nil {
+		return err
+	} else if !ok {
+		os.Remove(jarPath)
+		return fmt.Errorf("invalid server launcher from %s", rawurl)
+	}
+	return nil
+}
+
+// Edition returns the edition ID and name for Fabric.
+func (FabricProvider) Edition() (id string, name string) {
+	return "fabric", "Fabric"
+}
+
+// Versions returns all available server versions for the edition. For Fabric,
+// it returns the supported game versions, each of which resolves to the latest
+// stable loader and installer versions.
+func (fp *FabricProvider) Versions(ctx context.Context) ([]string, error) {
+	ctx = fp.restrictHostnames(ctx)
+	if err := fp.fetchManifest(ctx, false); err != nil {
+		return nil, err
+	}
+
+	versionIDs := make([]string, 0, len(fp.gameVersions))
+	for _, vInfo := range fp.gameVersions {
+		versionIDs = append(versionIDs, vInfo.Version)
+	}
+	return versionIDs, nil
+}
+
+// DefaultVersion returns the default version for the edition. For Fabric, it
+// always returns "stable".
+func (FabricProvider) DefaultVersion() string {
+	return "stable"
+}
+
+// ResolveVersion resolves a version identifier to a fixed version identifier.
+// For Fabric, version identifiers take the form
+// <game>[+loader<loader>][+installer<installer>] (e.g. 1.16.1+loader0.9.0),
+// where each component may also be "stable" or "latest". Omitted loader and
+// installer versions resolve to their latest stable versions. Fixed versions
+// always include all three components.
+func (fp *FabricProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	ctx = fp.restrictHostnames(ctx)
+	if err := fp.fetchManifest(ctx, false); err != nil {
+		return "", err
+	}
+
+	fv, err := fp.resolveVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return fv.String(), nil
+}
+
+// IsFetchNeeded returns whether the server resources for the edition and a
+// specified version are not available locally and require fetching. For
+// Fabric, it checks if the vanilla server JAR is available as it would for
+// Minecraft: Java Edition, and whether the Fabric server launcher exists
+// locally as a readable JAR.
+func (fp *FabricProvider) IsFetchNeeded(ctx context.Context, baseDir, version string) (bool, error) {
+	ctx = fp.restrictHostnames(ctx)
+	fv, err := parseFabricVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	if ok, err := fp.isLauncherValid(baseDir); err != nil || !ok {
+		return !ok, err
+	}
+	return fp.vanilla().IsFetchNeeded(ctx, baseDir, fv.Game)
+}
+
+// Fetch fetches (downloads) server resources into a specified base directory.
+// For Fabric, it downloads the vanilla server JAR from Mojang and the Fabric
+// server launcher for the loader and installer versions to the base directory.
+// As the meta API does not publish checksums for launchers, the launcher is only
+// checked to be a valid JAR.
+func (fp *FabricProvider) Fetch(ctx context.Context, baseDir, version string) error {
+	ctx = fp.restrictHostnames(ctx)
+	if err := fp.fetchManifest(ctx, false); err != nil {
+		return err
+	}
+
+	fv, err := fp.resolveVersion(version)
+	if err != nil {
+		return err
+	}
+
+	isJavaFetchNeeded, err := fp.vanilla().IsFetchNeeded(ctx, baseDir, fv.Game)
+	if err != nil {
+		return err
+	}
+	if isJavaFetchNeeded {
+		if err := fp.vanilla().Fetch(ctx, baseDir, fv.Game); err != nil {
+			return err
+		}
+	}
+
+	return fp.fetchLauncher(ctx, baseDir, fv)
+}
+
+// IsPrepareNeeded returns whether the server resources for the edition and a
+// specified version are not available for immediate use and required
+// additional preparation. For Fabric, it always returns false and a nil error.
+func (FabricProvider) IsPrepareNeeded(_ context.Context, _, _ string) (bool, error) {
+	return false, nil // There is no preparation step for Fabric
+}
+
+// Prepare prepares (preprocesses) fetched server resources such that they are
+// immediately useable without any further modifications. For Fabric, it is
+// effectively a no-op.
+func (FabricProvider) Prepare(_ context.Context, _, _ string) error {
+	return nil // There is no preparation step for Fabric
+}
+
+// Run runs a server within a specified working directory. Server resources
+// should have been previously fetched to the same base directory and for the
+// same version prior to calling Run. Runtime arguments are passed as JVM
+// options and server arguments are passed to the Fabric server launcher.
+// Either argument parameter may be nil if no arguments need to be specified.
+func (fp *FabricProvider) Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error {
+	gameJARPath, err := filepath.Abs(fp.java.jarPath(baseDir))
+	if err != nil {
+		return err
+	}
+
+	// Point the launcher at the vanilla server JAR in the base directory rather
+	// than letting it download one into the working directory.
+	args := make([]string, 0, len(runtimeArgs)+1)
+	args = append(args, runtimeArgs...)
+	args = append(args, "-Dfabric.installer.server.gameJar="+gameJARPath)
+	return runJAR(ctx, fp.launcherJARPath(baseDir), workingDir, args, serverArgs, serverStopCommand)
+}
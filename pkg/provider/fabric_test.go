@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newFabricMetaServer serves the version lists of a Fabric meta API, and a
+// server launcher whose body is launcher for 1.16.5 with loader 0.11.3 and
+// installer 0.7.2. It returns the base URL of the meta API.
+func newFabricMetaServer(t *testing.T, launcher []byte) string {
+	t.Helper()
+	lists := map[string][]fabricVersionInfo{
+		"/v2/versions/game": {
+			{Version: "21w11a", Stable: false},
+			{Version: "1.16.5", Stable: true},
+			{Version: "1.16.4", Stable: true},
+		},
+		"/v2/versions/loader": {
+			{Version: "0.11.4", Stable: false},
+			{Version: "0.11.3", Stable: true},
+		},
+		"/v2/versions/installer": {
+			{Version: "0.7.2", Stable: true},
+			{Version: "0.7.1", Stable: true},
+		},
+	}
+	mux := http.NewServeMux()
+	for path, list := range lists {
+		b, err := json.Marshal(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) { w.Write(b) })
+	}
+	mux.HandleFunc("/v2/versions/loader/1.16.5/0.11.3/0.7.2/server/jar", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(launcher)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL + "/v2"
+}
+
+// fabricLauncher returns a stand-in Fabric server launcher JAR.
+func fabricLauncher(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("META-INF/MANIFEST.MF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Main-Class: net.fabricmc.loader.launch.server.FabricServerLauncher\n"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFabricResolveVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		{"1.16.5", "1.16.5+loader0.11.3+installer0.7.2", false},
+		{"stable", "1.16.5+loader0.11.3+installer0.7.2", false},
+		{"latest", "21w11a+loader0.11.3+installer0.7.2", false},
+		{"1.16.4+loaderlatest", "1.16.4+loader0.11.4+installer0.7.2", false},
+		{"1.16.4+installer0.7.1+loader0.11.3", "1.16.4+loader0.11.3+installer0.7.1", false},
+		{"1.17", "", true},
+		{"1.16.5+loader0.10.0", "", true},
+		{"1.16.5+installer0.6.0", "", true},
+		{"+loader0.11.3", "", true},
+		{"1.16.5+forge", "", true},
+		{"1.16.5+loader0.11.3+loader0.11.4", "", true},
+	}
+	fp := &FabricProvider{MetaURL: newFabricMetaServer(t, nil)}
+	for _, tt := range tests {
+		got, err := fp.ResolveVersion(context.Background(), tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveVersion(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestFabricFetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		launcher func(t *testing.T) []byte
+		wantErr  bool
+	}{
+		{
+			name:     "valid launcher",
+			launcher: fabricLauncher,
+		},
+		{
+			name: "truncated launcher",
+			launcher: func(t *testing.T) []byte {
+				b := fabricLauncher(t)
+				return b[:len(b)/2]
+			},
+			wantErr: true,
+		},
+		{
+			name:     "not a JAR",
+			launcher: func(t *testing.T) []byte { return []byte("<html>Bad Gateway</html>") },
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := &resourceServer{resources: mojangResources("server")}
+			ctx := withMojangServer(t, context.Background(), origin)
+			fp := &FabricProvider{
+				MetaURL: newFabricMetaServer(t, tt.launcher(t)),
+				Java:    &JavaProvider{},
+			}
+			const version = "1.16.5+loader0.11.3+installer0.7.2"
+
+			baseDir := tempDir(t)
+			if needed, err := fp.IsFetchNeeded(ctx, baseDir, version); err != nil || !needed {
+				t.Fatalf("IsFetchNeeded before Fetch = %v, %v; want true, nil", needed, err)
+			}
+			err := fp.Fetch(ctx, baseDir, version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			needed, err := fp.IsFetchNeeded(ctx, baseDir, version)
+			if err != nil || needed != tt.wantErr {
+				t.Errorf("IsFetchNeeded after Fetch = %v, %v; want %v, nil", needed, err, tt.wantErr)
+			}
+			_, err = os.Stat(filepath.Join(baseDir, fabricLauncherJARFilename))
+			if tt.wantErr && !os.IsNotExist(err) {
+				t.Errorf("invalid launcher not removed: %v", err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("launcher not fetched: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Filename of the marker created in a base directory once Prepare completes
+// successfully
+const preparedMarkerFilename string = ".mcl-prepared"
+
+// fileExists returns whether a file exists at a path.
+func fileExists(path string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isPrepared returns whether the prepared marker exists in a base directory.
+func isPrepared(baseDir string) (bool, error) {
+	return fileExists(filepath.Join(baseDir, preparedMarkerFilename))
+}
+
+// markPrepared creates the prepared marker in a base directory.
+func markPrepared(baseDir string) error {
+	return ioutil.WriteFile(filepath.Join(baseDir, preparedMarkerFilename), nil, 0644)
+}
+
+// unmarkPrepared removes the prepared marker from a base directory if it
+// exists.
+func unmarkPrepared(baseDir string) error {
+	if err := os.Remove(filepath.Join(baseDir, preparedMarkerFilename)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// copyFile copies the contents of a file to a new file, which must not exist.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,428 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ForgeProvider is a provider for Minecraft: Java Edition servers with the
+// Forge or NeoForge mod loader. Servers are installed by running the installer
+// published for each version during Prepare.
+type ForgeProvider struct {
+	// Distribution is the mod loader distribution, either "forge" or
+	// "neoforge". If empty, "forge" is used.
+	Distribution string
+
+	// MavenURL is the base URL of the Maven repository hosting the
+	// distribution. If empty, the official repository for the distribution is
+	// used.
+	MavenURL string
+
+	// AcceptedHostnames restricts the hostnames that the provider may request,
+	// including those of URLs listed by manifests and of redirects, to those
+	// listed and their subdomains (see AnyHostname). The hostnames of the Maven
+	// repository and promotions are always accepted. If empty, only the
+	// hostnames of Forge and NeoForged are accepted.
+	AcceptedHostnames []string
+
+	// Cache, if non-nil, persistently caches the manifests provided by the Maven
+	// repository.
+	Cache *ManifestCache
+
+	// Logger receives the output of the installer while preparing servers. If
+	// nil, installer output is discarded.
+	Logger *zap.Logger
+
+	versions []string
+	aliases  map[string]string // Maps aliases (e.g. latest) to versions
+}
+
+// forgeDistribution describes where a Forge distribution publishes its
+// installers.
+type forgeDistribution struct {
+	name          string // Full name of the distribution
+	mavenURL      string // Base URL of the Maven repository
+	groupPath     string // Maven group ID as a path (e.g. net/minecraftforge)
+	artifactID    string // Maven artifact ID
+	promotionsURL string // URL of promoted versions, if any
+}
+
+const (
+	// Distribution used when none is specified
+	defaultForgeDistribution string = "forge"
+
+	// Filename of the installer JAR
+	forgeInstallerJARFilename string = "installer.jar"
+)
+
+var forgeDistributions = map[string]forgeDistribution{
+	"forge": {
+		name:          "Forge",
+		mavenURL:      "https://maven.minecraftforge.net",
+		groupPath:     "net/minecraftforge",
+		artifactID:    "forge",
+		promotionsURL: "https://files.minecraftforge.net/net/minecraftforge/forge/promotions_slim.json",
+	},
+	"neoforge": {
+		name:       "NeoForge",
+		mavenURL:   "https://maven.neoforged.net/releases",
+		groupPath:  "net/neoforged",
+		artifactID: "neoforge",
+	},
+}
+
+func (fp *ForgeProvider) distribution() (string, forgeDistribution) {
+	id := fp.Distribution
+	if id == "" {
+		id = defaultForgeDistribution
+	}
+	return id, forgeDistributions[id]
+}
+
+// forgeAcceptedHostnames are the hostnames accepted by default for Forge
+// distributions, which are those of their Maven repositories and promotions.
+var forgeAcceptedHostnames = []string{
+	"minecraftforge.net",
+	"neoforged.net",
+}
+
+func (fp *ForgeProvider) restrictHostnames(ctx context.Context) context.Context {
+	_, dist := fp.distribution()
+	mavenURL, _ := fp.artifactURL()
+	if len(fp.AcceptedHostnames) == 0 {
+		return restrictHostnames(ctx, forgeAcceptedHostnames, mavenURL, dist.promotionsURL)
+	}
+	return restrictHostnames(ctx, fp.AcceptedHostnames, mavenURL, dist.promotionsURL)
+}
+
+func (fp *ForgeProvider) artifactURL(elem ...string) (string, error) {
+	id, dist := fp.distribution()
+	if dist.artifactID == "" {
+		return "", errors.New("unknown distribution " + id)
+	}
+
+	mavenURL := fp.MavenURL
+	if mavenURL == "" {
+		mavenURL = dist.mavenURL
+	}
+	return strings.Join(append([]string{strings.TrimSuffix(mavenURL, "/"), dist.groupPath, dist.artifactID}, elem...), "/"), nil
+}
+
+func (fp *ForgeProvider) installerURL(version string) (string, error) {
+	_, dist := fp.distribution()
+	return fp.artifactURL(version, dist.artifactID+"-"+version+"-installer.jar")
+}
+
+func (fp *ForgeProvider) fetchManifest(ctx context.Context, force bool) error {
+	if force || fp.versions == nil {
+		metadataURL, err := fp.artifactURL("maven-metadata.xml")
+		if err != nil {
+			return err
+		}
+		var metadata struct {
+			Versioning struct {
+				Latest   string   `xml:"latest"`
+				Release  string   `xml:"release"`
+				Versions []string `xml:"versions>version"`
+			} `xml:"versioning"`
+		}
+		err = fp.Cache.get(ctx, metadataURL, func(b []byte) error {
+			return xml.Unmarshal(b, &metadata)
+		})
+		if err != nil {
+			return err
+		}
+		versions := metadata.Versioning.Versions
+		if len(versions) == 0 {
+			return errors.New("no versions available")
+		}
+
+		aliases := make(map[string]string)
+		switch {
+		case metadata.Versioning.Release != "":
+			aliases["latest"] = metadata.Versioning.Release
+		case metadata.Versioning.Latest != "":
+			aliases["latest"] = metadata.Versioning.Latest
+		default:
+			aliases["latest"] = versions[len(versions)-1]
+		}
+
+		// Add promoted versions (e.g. 1.16.1-recommended) as aliases if the
+		// distribution publishes them.
+		if _, dist := fp.distribution(); dist.promotionsURL != "" {
+			var promotions struct {
+				Promos map[string]string `json:"promos"`
+			}
+			if err := fp.Cache.getJSON(ctx, dist.promotionsURL, &promotions); err != nil {
+				return err
+			}
+			for alias, promoted := range promotions.Promos {
+				gameVersion := alias[:strings.LastIndexByte(alias, '-')+1] // Includes trailing hyphen
+				if version, ok := findForgeVersion(versions, gameVersion+promoted); ok {
+					aliases[alias] = version
+				}
+			}
+		}
+
+		fp.versions = versions
+		fp.aliases = aliases
+	}
+
+	return nil
+}
+
+// findForgeVersion returns the version in versions that matches a version
+// identifier. Older Forge versions carry an additional suffix (e.g.
+// 1.7.10-10.13.4.1614-1.7.10), which is matched as well.
+func findForgeVersion(versions []string, version string) (string, bool) {
+	for _, v := range versions {
+		if v == version || strings.HasPrefix(v, version+"-") {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (ForgeProvider) installerPath(baseDir string) string {
+	return filepath.Join(baseDir, forgeInstallerJARFilename)
+}
+
+// argsFilePath returns the path of the JVM arguments file generated by the
+// installer for modern (1.17+) versions.
+func (fp *ForgeProvider) argsFilePath(baseDir, version string) string {
+	_, dist := fp.distribution()
+	filename := "unix_args.txt"
+	if runtime.GOOS == "windows" {
+		filename = "win_args.txt"
+	}
+	return filepath.Join(baseDir, "libraries", filepath.FromSlash(dist.groupPath), dist.artifactID, version, filename)
+}
+
+// Edition returns the edition ID and name for the Forge distribution.
+func (fp *ForgeProvider) Edition() (id string, name string) {
+	id, dist := fp.distribution()
+	if dist.name == "" {
+		return id, id
+	}
+	return id, dist.name
+}
+
+// Versions returns all available server versions for the edition. For Forge
+// distributions, it returns all versions published to the Maven repository.
+func (fp *ForgeProvider) Versions(ctx context.Context) ([]string, error) {
+	ctx = fp.restrictHostnames(ctx)
+	if err := fp.fetchManifest(ctx, false); err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, len(fp.versions))
+	copy(versions, fp.versions)
+	return versions, nil
+}
+
+// DefaultVersion returns the default version for the edition. For Forge
+// distributions, it always returns "latest".
+func (ForgeProvider) DefaultVersion() string {
+	return "latest"
+}
+
+// ResolveVersion resolves a version identifier to a fixed version identifier.
+// For Forge distributions, "latest" resolves to the latest release. Forge also
+// resolves its promoted versions (e.g. 1.16.1-recommended or 1.16.1-latest).
+func (fp *ForgeProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	ctx = fp.restrictHostnames(ctx)
+	if err := fp.fetchManifest(ctx, false); err != nil {
+		return "", err
+	}
+
+	if v, ok := fp.aliases[version]; ok {
+		return v, nil
+	}
+	for _, v := range fp.versions {
+		if v == version {
+			return v, nil
+		}
+	}
+	return "", errors.New("version not found")
+}
+
+// IsFetchNeeded returns whether the server resources for the edition and a
+// specified version are not available locally and require fetching. For Forge
+// distributions, it checks if the installer JAR exists locally, and if so,
+// compares the SHA-1 checksum with that published to the Maven repository.
+func (fp *ForgeProvider) IsFetchNeeded(ctx context.Context, baseDir, version string) (bool, error) {
+	ctx = fp.restrictHostnames(ctx)
+	installerURL, err := fp.installerURL(version)
+	if err != nil {
+		return false, err
+	}
+	expectedSHA1, err := fp.fetchInstallerSHA1(ctx, installerURL)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := fileHashMatches(fp.installerPath(baseDir), sha1.New(), expectedSHA1)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+// Fetch fetches (downloads) server resources into a specified base directory.
+// For Forge distributions, it downloads the installer JAR for the version to
+// the base directory, verifying it against the SHA-1 checksum published to the
+// Maven repository. Any previous installation is invalidated.
+func (fp *ForgeProvider) Fetch(ctx context.Context, baseDir, version string) error {
+	ctx = fp.restrictHostnames(ctx)
+	installerURL, err := fp.installerURL(version)
+	if err != nil {
+		return err
+	}
+	expectedSHA1, err := fp.fetchInstallerSHA1(ctx, installerURL)
+	if err != nil {
+		return err
+	}
+
+	if err := unmarkPrepared(baseDir); err != nil {
+		return err
+	}
+	return downloadVerifiedFile(ctx, installerURL, fp.installerPath(baseDir), sha1.New(), expectedSHA1, 0)
+}
+
+// fetchInstallerSHA1 returns the hex-encoded SHA-1 checksum of an installer
+// JAR, as published alongside it in the Maven repository.
+func (fp *ForgeProvider) fetchInstallerSHA1(ctx context.Context, installerURL string) (string, error) {
+	var expectedSHA1 string
+	err := fp.Cache.get(ctx, installerURL+".sha1", func(b []byte) error {
+		expectedSHA1 = strings.TrimSpace(string(b))
+		return nil
+	})
+	return expectedSHA1, err
+}
+
+// IsPrepareNeeded returns whether the server resources for the edition and a
+// specified version are not available for immediate use and required
+// additional preparation. For Forge distributions, it checks whether the
+// installer previously completed successfully in the base directory.
+func (ForgeProvider) IsPrepareNeeded(_ context.Context, baseDir, _ string) (bool, error) {
+	prepared, err := isPrepared(baseDir)
+	return !prepared, err
+}
+
+// Prepare prepares (preprocesses) fetched server resources such that they are
+// immediately useable without any further modifications. For Forge
+// distributions, it runs the installer to install the server into the base
+// directory, logging the installer output and reporting it as progress to the
+// progress observer of the context, if any. If the context has a blob store,
+// the installed libraries are added to it to be shared with other versions.
+func (fp *ForgeProvider) Prepare(ctx context.Context, baseDir, _ string) error {
+	absBaseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "java", "-jar", fp.installerPath(absBaseDir), "--installServer", absBaseDir)
+	cmd.Dir = absBaseDir
+	pt := newProgressTracker(ctx, "Forge installer", 0)
+	if err := runLogged(cmd, fp.Logger, pt); err != nil {
+		return err
+	}
+	if err := addBlobDir(ctx, filepath.Join(baseDir, "libraries")); err != nil {
+		return err
+	}
+
+	// Mark the installation as complete only once the installer succeeds
+	return markPrepared(baseDir)
+}
+
+// Run runs a server within a specified working directory. Server resources
+// should have been previously fetched and prepared to the same base directory
+// and for the same version prior to calling Run. Runtime arguments are passed
+// as JVM options and server arguments are passed to the server. Either argument
+// parameter may be nil if no arguments need to be specified.
+func (fp *ForgeProvider) Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error {
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+
+	// Modern versions generate a JVM arguments file that replaces -jar
+	argsFile, err := ioutil.ReadFile(fp.argsFilePath(baseDir, version))
+	if os.IsNotExist(err) {
+		jarPath, err := fp.legacyJARPath(baseDir, version)
+		if err != nil {
+			return err
+		}
+		return runJAR(ctx, jarPath, workingDir, runtimeArgs, serverArgs, serverStopCommand)
+	} else if err != nil {
+		return err
+	}
+
+	fileArgs := absArgs(baseDir, strings.Fields(string(argsFile)))
+	args := make([]string, 0, len(runtimeArgs)+len(fileArgs)+len(serverArgs))
+	args = append(args, runtimeArgs...)
+	args = append(args, fileArgs...)
+	args = append(args, serverArgs...)
+	return runJava(ctx, workingDir, args, serverStopCommand)
+}
+
+// legacyJARPath returns the path of the server JAR generated by the installer
+// for legacy (pre-1.17) versions.
+func (fp *ForgeProvider) legacyJARPath(baseDir, version string) (string, error) {
+	_, dist := fp.distribution()
+	matches, err := filepath.Glob(filepath.Join(baseDir, dist.artifactID+"-"+version+"*.jar"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", errors.New("installed server not found")
+	}
+	return matches[0], nil
+}
+
+// absArgs rewrites arguments from an installer-generated arguments file, which
+// reference paths relative to the base directory, such that they may be used
+// from any working directory. Path lists and -D property values are rewritten
+// element-wise, and only elements that exist relative to the base directory are
+// made absolute.
+func absArgs(baseDir string, args []string) []string {
+	rewritten := make([]string, len(args))
+	for i, arg := range args {
+		prefix, value := "", arg
+		if strings.HasPrefix(arg, "-D") {
+			if j := strings.IndexByte(arg, '='); j >= 0 {
+				prefix, value = arg[:j+1], arg[j+1:]
+			}
+		}
+
+		elems := filepath.SplitList(value)
+		changed := false
+		for j, elem := range elems {
+			if elem == "" || filepath.IsAbs(elem) {
+				continue
+			}
+			path := filepath.Join(baseDir, elem)
+			if _, err := os.Stat(path); err == nil {
+				elems[j] = path
+				changed = true
+			}
+		}
+
+		if changed {
+			rewritten[i] = prefix + strings.Join(elems, string(os.PathListSeparator))
+		} else {
+			rewritten[i] = arg
+		}
+	}
+	return rewritten
+}
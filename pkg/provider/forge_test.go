@@ -0,0 +1,254 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const forgeTestMetadata = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata>
+  <groupId>net.minecraftforge</groupId>
+  <artifactId>forge</artifactId>
+  <versioning>
+    <latest>1.16.5-36.2.0</latest>
+    <release>1.16.5-36.2.0</release>
+    <versions>
+      <version>1.7.10-10.13.4.1614-1.7.10</version>
+      <version>1.16.5-36.1.0</version>
+      <version>1.16.5-36.2.0</version>
+    </versions>
+  </versioning>
+</metadata>
+`
+
+const forgeTestPromotions = `{
+  "homepage": "https://files.minecraftforge.net/net/minecraftforge/forge/",
+  "promos": {
+    "1.7.10-recommended": "10.13.4.1614",
+    "1.12.2-latest": "14.23.5.2855",
+    "1.16.5-latest": "36.2.0",
+    "1.16.5-recommended": "36.1.0"
+  }
+}
+`
+
+// newForgeTestProvider returns a provider for a Forge distribution whose Maven
+// repository and promotions are served from a local server. The Maven
+// repository holds an installer for 1.16.5-36.2.0, whose body is installer.
+func newForgeTestProvider(t *testing.T, installer string) *ForgeProvider {
+	t.Helper()
+	sum := sha1.Sum([]byte(installer))
+	resources := map[string]string{
+		"/maven/net/minecraftforge/forge/maven-metadata.xml":                                   forgeTestMetadata,
+		"/maven/net/minecraftforge/forge/1.16.5-36.2.0/forge-1.16.5-36.2.0-installer.jar":      installer,
+		"/maven/net/minecraftforge/forge/1.16.5-36.2.0/forge-1.16.5-36.2.0-installer.jar.sha1": hex.EncodeToString(sum[:]),
+		"/promotions_slim.json": forgeTestPromotions,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, ok := resources[r.URL.Path]; ok {
+			w.Write([]byte(body))
+		} else {
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// Register a distribution as the promotions URL is fixed per distribution
+	forgeDistributions["test"] = forgeDistribution{
+		name:          "Test",
+		mavenURL:      srv.URL + "/maven",
+		groupPath:     "net/minecraftforge",
+		artifactID:    "forge",
+		promotionsURL: srv.URL + "/promotions_slim.json",
+	}
+	t.Cleanup(func() { delete(forgeDistributions, "test") })
+	return &ForgeProvider{Distribution: "test"}
+}
+
+func TestForgeResolveVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		{"latest", "1.16.5-36.2.0", false},
+		{"1.16.5-latest", "1.16.5-36.2.0", false},
+		{"1.16.5-recommended", "1.16.5-36.1.0", false},
+		{"1.7.10-recommended", "1.7.10-10.13.4.1614-1.7.10", false},
+		{"1.16.5-36.1.0", "1.16.5-36.1.0", false},
+		{"1.12.2-latest", "", true}, // Promoted version is not in the repository
+		{"1.16.5-36.0.0", "", true},
+		{"1.16.5", "", true},
+	}
+	fp := newForgeTestProvider(t, "")
+	for _, tt := range tests {
+		got, err := fp.ResolveVersion(context.Background(), tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveVersion(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+// stubForgeInstallerScript stands in for java running a Forge installer. It
+// installs a legacy server JAR and a library into the directory following
+// --installServer, unless the installer JAR reads "fail".
+const stubForgeInstallerScript = `#!/bin/sh
+[ "$1" = -jar ] && [ "$3" = --installServer ] || exit 2
+[ "$(cat "$2")" = fail ] && exit 1
+mkdir -p "$4/libraries" &&
+echo library > "$4/libraries/library.jar" &&
+echo server > "$4/forge-1.16.5-36.2.0.jar"
+`
+
+func TestForgePrepare(t *testing.T) {
+	installStubJava(t, stubForgeInstallerScript)
+
+	tests := []struct {
+		installer string
+		wantErr   bool
+	}{
+		{installer: "installer"},
+		{installer: "fail", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.installer, func(t *testing.T) {
+			ctx := context.Background()
+			fp := newForgeTestProvider(t, tt.installer)
+			const version = "1.16.5-36.2.0"
+
+			baseDir := tempDir(t)
+			if err := fp.Fetch(ctx, baseDir, version); err != nil {
+				t.Fatalf("Fetch error = %v", err)
+			}
+			if needed, err := fp.IsFetchNeeded(ctx, baseDir, version); err != nil || needed {
+				t.Errorf("IsFetchNeeded after Fetch = %v, %v; want false, nil", needed, err)
+			}
+			if needed, err := fp.IsPrepareNeeded(ctx, baseDir, version); err != nil || !needed {
+				t.Errorf("IsPrepareNeeded before Prepare = %v, %v; want true, nil", needed, err)
+			}
+
+			err := fp.Prepare(ctx, baseDir, version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Prepare error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if needed, err := fp.IsPrepareNeeded(ctx, baseDir, version); err != nil || needed != tt.wantErr {
+				t.Errorf("IsPrepareNeeded after Prepare = %v, %v; want %v, nil", needed, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			jarPath, err := fp.legacyJARPath(baseDir, version)
+			if want := filepath.Join(baseDir, "forge-1.16.5-36.2.0.jar"); err != nil || jarPath != want {
+				t.Errorf("legacyJARPath = %q, %v; want %q, nil", jarPath, err, want)
+			}
+
+			// Fetching again invalidates the installation
+			if err := fp.Fetch(ctx, baseDir, version); err != nil {
+				t.Fatalf("Fetch error = %v", err)
+			}
+			if needed, err := fp.IsPrepareNeeded(ctx, baseDir, version); err != nil || !needed {
+				t.Errorf("IsPrepareNeeded after refetch = %v, %v; want true, nil", needed, err)
+			}
+		})
+	}
+}
+
+func TestForgeLegacyJARPath(t *testing.T) {
+	tests := []struct {
+		files   []string
+		version string
+		want    string
+		wantErr bool
+	}{
+		{
+			files:   []string{"installer.jar", "forge-1.12.2-14.23.5.2855.jar"},
+			version: "1.12.2-14.23.5.2855",
+			want:    "forge-1.12.2-14.23.5.2855.jar",
+		},
+		{
+			files:   []string{"installer.jar", "forge-1.7.10-10.13.4.1614-1.7.10-universal.jar"},
+			version: "1.7.10-10.13.4.1614-1.7.10",
+			want:    "forge-1.7.10-10.13.4.1614-1.7.10-universal.jar",
+		},
+		{
+			files:   []string{"installer.jar", "minecraft_server.1.12.2.jar"},
+			version: "1.12.2-14.23.5.2855",
+			wantErr: true,
+		},
+		{
+			files:   []string{"forge-1.12.2-14.23.5.2854.jar"},
+			version: "1.12.2-14.23.5.2855",
+			wantErr: true,
+		},
+	}
+	fp := &ForgeProvider{}
+	for _, tt := range tests {
+		baseDir := tempDir(t)
+		for _, name := range tt.files {
+			if err := ioutil.WriteFile(filepath.Join(baseDir, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := fp.legacyJARPath(baseDir, tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("legacyJARPath(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != filepath.Join(baseDir, tt.want) {
+			t.Errorf("legacyJARPath(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestAbsArgs(t *testing.T) {
+	baseDir := tempDir(t)
+	for _, name := range []string{"libraries/a.jar", "libraries/b.jar"} {
+		path := filepath.Join(baseDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(elems ...string) string { return strings.Join(elems, string(os.PathListSeparator)) }
+	abs := func(name string) string { return filepath.Join(baseDir, filepath.FromSlash(name)) }
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"libraries/a.jar", abs("libraries/a.jar")},
+		{list("libraries/a.jar", "libraries/b.jar"), list(abs("libraries/a.jar"), abs("libraries/b.jar"))},
+		{list("libraries/a.jar", "missing.jar"), list(abs("libraries/a.jar"), "missing.jar")},
+		{"-DlegacyClassPath=" + list("libraries/a.jar", "libraries/b.jar"), "-DlegacyClassPath=" + list(abs("libraries/a.jar"), abs("libraries/b.jar"))},
+		{"-Dfile.encoding=UTF-8", "-Dfile.encoding=UTF-8"},
+		{"--launchTarget", "--launchTarget"},
+		{"forgeserver", "forgeserver"},
+		{"-Dlibraries/a.jar", "-Dlibraries/a.jar"},
+		{abs("libraries/a.jar"), abs("libraries/a.jar")},
+	}
+	args := make([]string, len(tests))
+	want := make([]string, len(tests))
+	for i, tt := range tests {
+		args[i], want[i] = tt.arg, tt.want
+	}
+	if got := absArgs(baseDir, args); !reflect.DeepEqual(got, want) {
+		t.Errorf("absArgs(%q) = %q, want %q", args, got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+// fileHashMatches returns whether a file exists and its digest, as computed by
+// h, matches an expected hex-encoded digest. It returns false and a nil error
+// if the file does not exist.
+func fileHashMatches(path string, h hash.Hash, expectedHex string) (bool, error) {
+	expected, err := hex.DecodeString(expectedHex)
+	if err != nil {
+		return false, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	return bytes.Equal(h.Sum(nil), expected), nil
+}
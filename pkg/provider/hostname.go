@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ErrHostnameNotAccepted is returned, possibly wrapped, when a provider would
+// request a URL whose hostname it does not accept (e.g. from a tampered
+// manifest).
+var ErrHostnameNotAccepted = errors.New("hostname not accepted")
+
+// AnyHostname is an accepted hostname that accepts all hostnames.
+const AnyHostname string = "*"
+
+// Maximum number of redirects followed for a request
+const maxRedirects int = 10
+
+type acceptedHostnamesKey struct{}
+
+// restrictHostnames returns a copy of a parent context in which requests are
+// restricted to URLs with accepted hostnames, as determined by
+// isAcceptedHostname. The hostnames of any URLs configured for the provider
+// (e.g. API URLs) are also accepted. Providers pass their default hostnames if
+// none are configured, so requests are always restricted unless AnyHostname is
+// accepted.
+func restrictHostnames(parent context.Context, acceptedHostnames []string, configuredURLs ...string) context.Context {
+	hostnames := make([]string, 0, len(acceptedHostnames)+len(configuredURLs))
+	hostnames = append(hostnames, acceptedHostnames...)
+	for _, rawurl := range configuredURLs {
+		if u, err := url.Parse(rawurl); err == nil && u.Hostname() != "" {
+			hostnames = append(hostnames, u.Hostname())
+		}
+	}
+	return context.WithValue(parent, acceptedHostnamesKey{}, hostnames)
+}
+
+// isAcceptedHostname returns whether the hostname of a URL is accepted. A
+// hostname is accepted if it is, or is a subdomain of, any accepted hostname,
+// or if any accepted hostname is AnyHostname. An accepted hostname may instead
+// be a URL (e.g. https://example.com/files/), which only accepts URLs with the
+// same scheme and hostname whose cleaned path begins with its path. Hostnames
+// are compared without regard to case, and URLs that cannot be parsed are never
+// accepted.
+func isAcceptedHostname(rawurl string, acceptedHostnames []string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	hostname := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if hostname == "" {
+		return false
+	}
+
+	for _, accepted := range acceptedHostnames {
+		if accepted == AnyHostname {
+			return true
+		}
+		if strings.Contains(accepted, "/") {
+			if hasURLPrefix(u, accepted) {
+				return true
+			}
+			continue
+		}
+		accepted = strings.TrimSuffix(strings.ToLower(accepted), ".")
+		if hostname == accepted || strings.HasSuffix(hostname, "."+accepted) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasURLPrefix returns whether a URL has the same scheme and hostname as a
+// prefix URL, and a cleaned path beginning with its path.
+func hasURLPrefix(u *url.URL, prefix string) bool {
+	p, err := url.Parse(prefix)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Scheme, p.Scheme) &&
+		strings.EqualFold(u.Host, p.Host) &&
+		strings.HasPrefix(path.Clean("/"+u.Path), p.Path)
+}
+
+// checkHostname returns an error if the hostname of a URL is not accepted for
+// a context. All hostnames are accepted if the context restricts none.
+func checkHostname(ctx context.Context, rawurl string) error {
+	acceptedHostnames, ok := ctx.Value(acceptedHostnamesKey{}).([]string)
+	if !ok || isAcceptedHostname(rawurl, acceptedHostnames) {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", rawurl, ErrHostnameNotAccepted)
+}
+
+// checkRedirect is the redirect policy for HTTP clients used by providers,
+// which only follows redirects to accepted hostnames.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return checkHostname(req.Context(), req.URL.String())
+}
@@ -0,0 +1,29 @@
+package provider
+
+import "testing"
+
+func TestIsAcceptedHostname(t *testing.T) {
+	tests := []struct {
+		rawurl string
+		want   bool
+	}{
+		{"https://launchermeta.mojang.com/mc/game/version_manifest.json", true},
+		{"https://MOJANG.com./", true},
+		{"https://notmojang.com/", false},
+		{"https://s3.amazonaws.com/Minecraft.Download/versions/1.0/minecraft_server.1.0.jar", true},
+		{"https://s3.amazonaws.com/Minecraft.Download/versions/../../other/server.jar", false},
+		{"https://s3.amazonaws.com/other/server.jar", false},
+		{"http://s3.amazonaws.com/Minecraft.Download/versions/1.0/minecraft_server.1.0.jar", false},
+		{"https://bucket.s3.amazonaws.com/Minecraft.Download/versions/", false},
+		{"://invalid", false},
+	}
+	for _, tt := range tests {
+		if got := isAcceptedHostname(tt.rawurl, javaAcceptedHostnames); got != tt.want {
+			t.Errorf("isAcceptedHostname(%q) = %v, want %v", tt.rawurl, got, tt.want)
+		}
+	}
+
+	if !isAcceptedHostname("https://example.com/", []string{"mojang.com", AnyHostname}) {
+		t.Error("AnyHostname does not accept all hostnames")
+	}
+}
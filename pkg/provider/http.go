@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/snugfox/mcl/pkg/version"
+)
+
+// httpClient is the default client for requests sent by providers.
+var httpClient = &http.Client{CheckRedirect: checkRedirect}
+
+type httpClientKey struct{}
+
+// WithHTTPClient returns a copy of a parent context in which providers send
+// requests using an HTTP client instead of the default client, which has no
+// timeouts. Redirects are only followed to hostnames accepted by the provider
+// in addition to the client's own redirect policy.
+func WithHTTPClient(parent context.Context, client *http.Client) context.Context {
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := checkHostname(req.Context(), req.URL.String()); err != nil {
+			return err
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(req, via)
+		}
+		return checkRedirect(req, via)
+	}
+	return context.WithValue(parent, httpClientKey{}, &c)
+}
+
+// UserAgent returns the User-Agent header sent with requests by providers,
+// which identifies the version of MCL (e.g. mcl/1.0.0).
+func UserAgent() string {
+	if version.Version == "" {
+		return "mcl/devel"
+	}
+	return "mcl/" + strings.TrimPrefix(version.Version, "v")
+}
+
+// doRequest sends a request using the HTTP client of the request's context if
+// the hostname of its URL is accepted for the context. Redirects are likewise
+// only followed to accepted hostnames. The User-Agent header is set to
+// UserAgent if not already set.
+func doRequest(req *http.Request) (*http.Response, error) {
+	if err := checkHostname(req.Context(), req.URL.String()); err != nil {
+		return nil, err
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", UserAgent())
+	}
+
+	client, ok := req.Context().Value(httpClientKey{}).(*http.Client)
+	if !ok {
+		client = httpClient
+	}
+	return client.Do(req)
+}
+
+// httpGet sends a GET request for a URL and returns the response if the server
+// responded with 200 OK. The caller is responsible for closing the response
+// body. No request is sent if the context is offline.
+func httpGet(ctx context.Context, rawurl string) (*http.Response, error) {
+	if IsOffline(ctx) {
+		return nil, offlineError(rawurl)
+	}
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	res, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected response %q from %s", res.Status, rawurl)
+	}
+	return res, nil
+}
+
+// getJSON sends a GET request for a URL and decodes its JSON response body into
+// v.
+func getJSON(ctx context.Context, rawurl string, v interface{}) error {
+	res, err := httpGet(ctx, rawurl)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
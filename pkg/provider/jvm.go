@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+)
+
+// runJAR runs a JAR file with the java runtime within a specified working
+// directory. Runtime arguments are passed as JVM options and server arguments
+// are passed to the JAR. Either argument parameter may be nil if no arguments
+// need to be specified. The server is stopped with a stop command as
+// runAttached does.
+func runJAR(ctx context.Context, jarPath, workingDir string, runtimeArgs, serverArgs []string, stopCommand string) error {
+	jarPath, err := filepath.Abs(jarPath)
+	if err != nil {
+		return err
+	}
+
+	// Concatenate arguments
+	args := make([]string, 0, len(runtimeArgs)+len(serverArgs)+2)
+	args = append(args, runtimeArgs...)
+	args = append(args, "-jar", jarPath)
+	args = append(args, serverArgs...)
+	return runJava(ctx, workingDir, args, stopCommand)
+}
+
+// runJava runs the java runtime with the specified arguments within a working
+// directory, attaching all standard pipes to those of the current process as
+// runAttached does.
+func runJava(ctx context.Context, workingDir string, args []string, stopCommand string) error {
+	cmd := exec.Command("java", args...)
+	cmd.Dir = workingDir
+	return runAttached(ctx, cmd, stopCommand)
+}
@@ -0,0 +1,31 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrOffline is returned, possibly wrapped, when a provider requires a remote
+// resource that is unavailable locally while offline.
+var ErrOffline = errors.New("not available offline")
+
+type offlineKey struct{}
+
+// WithOffline returns a copy of a parent context in which providers operate
+// offline. Offline providers never access the network, and instead rely solely
+// on cached manifests and the contents of base directories.
+func WithOffline(parent context.Context) context.Context {
+	return context.WithValue(parent, offlineKey{}, true)
+}
+
+// IsOffline returns whether providers operate offline for a context.
+func IsOffline(ctx context.Context) bool {
+	offline, _ := ctx.Value(offlineKey{}).(bool)
+	return offline
+}
+
+// offlineError returns an error wrapping ErrOffline for a URL.
+func offlineError(rawurl string) error {
+	return fmt.Errorf("%s: %w", rawurl, ErrOffline)
+}
@@ -0,0 +1,350 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PaperMCProvider is a provider for server software published through the
+// PaperMC downloads API (e.g. Paper, or the Velocity and Waterfall proxies).
+type PaperMCProvider struct {
+	// Project is the PaperMC project ID (e.g. "paper"). If empty, the "paper"
+	// project is used.
+	Project string
+
+	// APIURL is the base URL of the PaperMC downloads API. If empty, the
+	// official PaperMC API is used.
+	APIURL string
+
+	// AcceptedHostnames restricts the hostnames that the provider may request,
+	// including those of URLs listed by manifests and of redirects, to those
+	// listed and their subdomains (see AnyHostname). The hostname of the API URL
+	// is always accepted. If empty, only the hostnames of PaperMC are accepted.
+	AcceptedHostnames []string
+
+	// Cache, if non-nil, persistently caches the manifests provided by the
+	// PaperMC API.
+	Cache *ManifestCache
+
+	versions  []string
+	builds    map[string][]int                 // Maps version to its builds in ascending order
+	downloads map[string]*paperMCBuildResource // Maps version-build to its download
+}
+
+type paperMCBuildResource struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"` // Hex-encoded
+}
+
+const (
+	// Base URL of the downloads API provided by PaperMC
+	paperMCAPIURL string = "https://api.papermc.io/v2"
+
+	// Project ID used when none is specified
+	defaultPaperMCProject string = "paper"
+)
+
+// paperMCProjectNames maps PaperMC project IDs to their full names.
+var paperMCProjectNames = map[string]string{
+	"paper":     "Paper",
+	"velocity":  "Velocity",
+	"waterfall": "Waterfall",
+}
+
+func (pp *PaperMCProvider) project() string {
+	if pp.Project == "" {
+		return defaultPaperMCProject
+	}
+	return pp.Project
+}
+
+// stopCommand returns the console command that stops servers of the project,
+// which are proxies for all projects but Paper.
+func (pp *PaperMCProvider) stopCommand() string {
+	if pp.project() == "paper" {
+		return serverStopCommand
+	}
+	return proxyStopCommand
+}
+
+// paperMCAcceptedHostnames are the hostnames accepted by default for PaperMC
+// projects, which are those used by PaperMC for its API and downloads.
+var paperMCAcceptedHostnames = []string{
+	"papermc.io",
+}
+
+func (pp *PaperMCProvider) restrictHostnames(ctx context.Context) context.Context {
+	if len(pp.AcceptedHostnames) == 0 {
+		return restrictHostnames(ctx, paperMCAcceptedHostnames, pp.projectURL())
+	}
+	return restrictHostnames(ctx, pp.AcceptedHostnames, pp.projectURL())
+}
+
+func (pp *PaperMCProvider) projectURL(elem ...string) string {
+	apiURL := pp.APIURL
+	if apiURL == "" {
+		apiURL = paperMCAPIURL
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(apiURL, "/"))
+	sb.WriteString("/projects/")
+	sb.WriteString(url.PathEscape(pp.project()))
+	for _, e := range elem {
+		sb.WriteByte('/')
+		sb.WriteString(url.PathEscape(e))
+	}
+	return sb.String()
+}
+
+func (pp *PaperMCProvider) fetchVersions(ctx context.Context, force bool) error {
+	if force || pp.versions == nil {
+		var project struct {
+			Versions []string `json:"versions"`
+		}
+		if err := pp.Cache.getJSON(ctx, pp.projectURL(), &project); err != nil {
+			return err
+		}
+		pp.versions = project.Versions
+	}
+
+	return nil
+}
+
+func (pp *PaperMCProvider) fetchBuilds(ctx context.Context, version string, force bool) ([]int, error) {
+	builds, ok := pp.builds[version]
+	if force || !ok {
+		var versionInfo struct {
+			Builds []int `json:"builds"`
+		}
+		if err := pp.Cache.getJSON(ctx, pp.projectURL("versions", version), &versionInfo); err != nil {
+			return nil, err
+		}
+		if len(versionInfo.Builds) == 0 {
+			return nil, errors.New("version has no builds")
+		}
+
+		builds = versionInfo.Builds
+		if pp.builds == nil {
+			pp.builds = make(map[string][]int)
+		}
+		pp.builds[version] = builds
+	}
+
+	return builds, nil
+}
+
+func (pp *PaperMCProvider) fetchBuildResource(ctx context.Context, version string, build int, force bool) (*paperMCBuildResource, error) {
+	key := formatPaperMCVersion(version, build)
+	resource, ok := pp.downloads[key]
+	if force || !ok {
+		var buildInfo struct {
+			Downloads struct {
+				Application *paperMCBuildResource `json:"application"`
+
+				// ...unused fields for other downloads...
+			} `json:"downloads"`
+
+			// ...other unused fields...
+		}
+		if err := pp.Cache.getJSON(ctx, pp.projectURL("versions", version, "builds", strconv.Itoa(build)), &buildInfo); err != nil {
+			return nil, err
+		}
+		if buildInfo.Downloads.Application == nil {
+			return nil, errors.New("build has no application download")
+		}
+
+		resource = buildInfo.Downloads.Application
+		if pp.downloads == nil {
+			pp.downloads = make(map[string]*paperMCBuildResource)
+		}
+		pp.downloads[key] = resource
+	}
+
+	return resource, nil
+}
+
+// hasVersion returns whether a version is known by the PaperMC API. Versions
+// must have been previously fetched.
+func (pp *PaperMCProvider) hasVersion(version string) bool {
+	for _, v := range pp.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVersion splits a fixed version identifier into its version and build.
+// Versions must have been previously fetched.
+func (pp *PaperMCProvider) parseVersion(version string) (string, int, error) {
+	i := strings.LastIndexByte(version, '-')
+	if i < 0 {
+		return "", 0, errors.New("version not found")
+	}
+	build, err := strconv.Atoi(version[i+1:])
+	if err != nil || !pp.hasVersion(version[:i]) {
+		return "", 0, errors.New("version not found")
+	}
+	return version[:i], build, nil
+}
+
+func formatPaperMCVersion(version string, build int) string {
+	return fmt.Sprintf("%s-%d", version, build)
+}
+
+func (PaperMCProvider) jarPath(baseDir string) string {
+	return filepath.Join(baseDir, serverJARFilename)
+}
+
+// Edition returns the edition ID and name for the PaperMC project.
+func (pp *PaperMCProvider) Edition() (id string, name string) {
+	id = pp.project()
+	name, ok := paperMCProjectNames[id]
+	if !ok {
+		name = id
+	}
+	return id, name
+}
+
+// Versions returns all available server versions for the edition. For PaperMC
+// projects, it returns the project versions (e.g. "1.16.1"), each of which
+// resolves to its latest build.
+func (pp *PaperMCProvider) Versions(ctx context.Context) ([]string, error) {
+	ctx = pp.restrictHostnames(ctx)
+	if err := pp.fetchVersions(ctx, false); err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, len(pp.versions))
+	copy(versions, pp.versions)
+	return versions, nil
+}
+
+// DefaultVersion returns the default version for the edition. For PaperMC
+// projects, it always returns "latest".
+func (PaperMCProvider) DefaultVersion() string {
+	return "latest"
+}
+
+// ResolveVersion resolves a version identifier to a fixed version identifier.
+// For PaperMC projects, fixed versions take the form <version>-<build> (e.g.
+// 1.16.1-100). "latest" resolves to the latest build of the latest version, and
+// a version without a build resolves to the latest build of that version.
+func (pp *PaperMCProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	ctx = pp.restrictHostnames(ctx)
+	if err := pp.fetchVersions(ctx, false); err != nil {
+		return "", err
+	}
+
+	if version == "latest" {
+		if len(pp.versions) == 0 {
+			return "", errors.New("no versions available")
+		}
+		version = pp.versions[len(pp.versions)-1]
+	}
+
+	// Resolve a version without a build to its latest build
+	if pp.hasVersion(version) {
+		builds, err := pp.fetchBuilds(ctx, version, false)
+		if err != nil {
+			return "", err
+		}
+		return formatPaperMCVersion(version, builds[len(builds)-1]), nil
+	}
+
+	// Otherwise, ensure that the build exists for the version
+	v, build, err := pp.parseVersion(version)
+	if err != nil {
+		return "", err
+	}
+	builds, err := pp.fetchBuilds(ctx, v, false)
+	if err != nil {
+		return "", err
+	}
+	for _, b := range builds {
+		if b == build {
+			return version, nil
+		}
+	}
+	return "", errors.New("build not found")
+}
+
+// IsFetchNeeded returns whether the server resources for the edition and a
+// specified version are not available locally and require fetching. For
+// PaperMC projects, it checks if the server JAR exists locally, and if so,
+// compares the SHA-256 checksum with that provided by the PaperMC API.
+func (pp *PaperMCProvider) IsFetchNeeded(ctx context.Context, baseDir, version string) (bool, error) {
+	ctx = pp.restrictHostnames(ctx)
+	if err := pp.fetchVersions(ctx, false); err != nil {
+		return false, err
+	}
+
+	v, build, err := pp.parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+	resource, err := pp.fetchBuildResource(ctx, v, build, false)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := fileHashMatches(pp.jarPath(baseDir), sha256.New(), resource.SHA256)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
+
+// Fetch fetches (downloads) server resources into a specified base directory.
+// For PaperMC projects, it downloads the server JAR for the build from the
+// PaperMC API to the base directory, verifying it against the SHA-256 checksum
+// provided by the PaperMC API.
+func (pp *PaperMCProvider) Fetch(ctx context.Context, baseDir, version string) error {
+	ctx = pp.restrictHostnames(ctx)
+	if err := pp.fetchVersions(ctx, false); err != nil {
+		return err
+	}
+
+	v, build, err := pp.parseVersion(version)
+	if err != nil {
+		return err
+	}
+	resource, err := pp.fetchBuildResource(ctx, v, build, false)
+	if err != nil {
+		return err
+	}
+
+	rawurl := pp.projectURL("versions", v, "builds", strconv.Itoa(build), "downloads", resource.Name)
+	return downloadVerifiedFile(ctx, rawurl, pp.jarPath(baseDir), sha256.New(), resource.SHA256, 0)
+}
+
+// IsPrepareNeeded returns whether the server resources for the edition and a
+// specified version are not available for immediate use and required
+// additional preparation. For PaperMC projects, it always returns false and a
+// nil error.
+func (PaperMCProvider) IsPrepareNeeded(_ context.Context, _, _ string) (bool, error) {
+	return false, nil // There is no preparation step for PaperMC projects
+}
+
+// Prepare prepares (preprocesses) fetched server resources such that they are
+// immediately useable without any further modifications. For PaperMC projects,
+// it is effectively a no-op.
+func (PaperMCProvider) Prepare(_ context.Context, _, _ string) error {
+	return nil // There is no preparation step for PaperMC projects
+}
+
+// Run runs a server within a specified working directory. Server resources
+// should have been previously fetched to the same base directory and for the
+// same version prior to calling Run. Runtime arguments are passed as JVM
+// options and server arguments are passed to the server JAR. Either argument
+// parameter may be nil if no arguments need to be specified.
+func (pp *PaperMCProvider) Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error {
+	return runJAR(ctx, pp.jarPath(baseDir), workingDir, runtimeArgs, serverArgs, pp.stopCommand())
+}
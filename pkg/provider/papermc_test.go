@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newPaperMCTestServer returns a stand-in for the PaperMC downloads API that
+// serves the paper project with builds of two versions. Each build downloads
+// body, and its reported checksum is that of sumOf.
+func newPaperMCTestServer(t *testing.T, body, sumOf string) *httptest.Server {
+	t.Helper()
+	sum := sha256.Sum256([]byte(sumOf))
+	builds := map[string][]int{
+		"1.16.4": {1, 2},
+		"1.16.5": {1, 2, 3},
+	}
+
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	mux.HandleFunc("/projects/paper", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"versions": []string{"1.16.4", "1.16.5"}})
+	})
+	mux.HandleFunc("/projects/paper/versions/", func(w http.ResponseWriter, r *http.Request) {
+		elem := strings.Split(strings.TrimPrefix(r.URL.Path, "/projects/paper/versions/"), "/")
+		switch {
+		case len(elem) == 1 && builds[elem[0]] != nil:
+			writeJSON(w, map[string]interface{}{"builds": builds[elem[0]]})
+		case len(elem) == 3 && elem[1] == "builds":
+			writeJSON(w, map[string]interface{}{
+				"downloads": map[string]interface{}{
+					"application": map[string]string{
+						"name":   "paper-" + elem[0] + "-" + elem[2] + ".jar",
+						"sha256": hex.EncodeToString(sum[:]),
+					},
+				},
+			})
+		case len(elem) == 5 && elem[3] == "downloads":
+			w.Write([]byte(body))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPaperMCResolveVersion(t *testing.T) {
+	srv := newPaperMCTestServer(t, "server", "server")
+	pp := &PaperMCProvider{APIURL: srv.URL}
+
+	tests := []struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		{version: "latest", want: "1.16.5-3"},
+		{version: "1.16.4", want: "1.16.4-2"},
+		{version: "1.16.4-1", want: "1.16.4-1"},
+		{version: "1.16.4-3", wantErr: true},
+		{version: "1.16.3", wantErr: true},
+		{version: "1.16.3-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := pp.ResolveVersion(context.Background(), tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveVersion(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveVersion(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestPaperMCFetchVerifies(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string // Downloaded body
+		sumOf   string // Body whose checksum the API reports
+		wantErr bool
+	}{
+		{name: "matching checksum", body: "server", sumOf: "server"},
+		{name: "mismatched checksum", body: "tampered", sumOf: "server", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newPaperMCTestServer(t, tt.body, tt.sumOf)
+			ctx := context.Background()
+			pp := &PaperMCProvider{APIURL: srv.URL}
+			baseDir := tempDir(t)
+			needed, err := pp.IsFetchNeeded(ctx, baseDir, "1.16.5-3")
+			if err != nil || !needed {
+				t.Fatalf("IsFetchNeeded before Fetch = %v, %v; want true, nil", needed, err)
+			}
+
+			err = pp.Fetch(ctx, baseDir, "1.16.5-3")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if ok, _ := fileExists(filepath.Join(baseDir, serverJARFilename)); ok {
+					t.Error("Fetch left an unverified server JAR")
+				}
+				return
+			}
+
+			b, err := ioutil.ReadFile(filepath.Join(baseDir, serverJARFilename))
+			if err != nil || string(b) != tt.body {
+				t.Errorf("server JAR = %q, %v; want %q", b, err, tt.body)
+			}
+			if needed, err := pp.IsFetchNeeded(ctx, baseDir, "1.16.5-3"); err != nil || needed {
+				t.Errorf("IsFetchNeeded after Fetch = %v, %v; want false, nil", needed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PluginProvider is a provider implemented out-of-process by a plugin
+// executable, which MCL communicates with over the plugin's standard input and
+// output.
+//
+// Each message is a single line of JSON. MCL sends requests of the form
+//
+//	{"id": 1, "method": "resolveVersion", "params": {"version": "latest"}}
+//
+// and the plugin replies to each with a response of the form
+//
+//	{"id": 1, "result": {"version": "1.0.0"}}
+//
+// or, if the request failed, {"id": 1, "error": "message"}. Responses may be
+// sent in any order. Requests made while offline (see WithOffline) also include
+// "offline": true, in which case the plugin must not access the network. When
+// a request's context is cancelled, MCL sends
+// {"id": 1, "method": "cancel"} with the ID of the cancelled request and stops
+// waiting for its response. The plugin should exit once its standard input is
+// closed, and may write diagnostic output to its standard error.
+//
+// The first request is always a "handshake" with params
+// {"protocolVersion": 1}, to which the plugin must reply within ten seconds
+// with {"protocolVersion": 1, "edition": {"id": "...", "name": "..."},
+// "defaultVersion": "..."}. The remaining methods and their params and results
+// mirror the Provider interface:
+//
+//	versions        {}                           {"versions": [...]}
+//	resolveVersion  {"version"}                  {"version"}
+//	isFetchNeeded   {"baseDir", "version"}       {"needed"}
+//	fetch           {"baseDir", "version"}       {}
+//	isPrepareNeeded {"baseDir", "version"}       {"needed"}
+//	prepare         {"baseDir", "version"}       {}
+//	run             {"baseDir", "workingDir", "version", "runtimeArgs",
+//	                 "serverArgs"}               {"path", "args", "env", "dir",
+//	                                              "stopCommand"}
+//
+// As the plugin's standard pipes are reserved for the protocol, run returns the
+// command that runs the server rather than running it, and MCL runs the
+// command itself. The optional "env" lists additional environment variables of
+// the form KEY=value, "dir" defaults to the working directory, and
+// "stopCommand" is the console command that stops the server gracefully,
+// which defaults to "stop".
+//
+// Plugins should be closed once no longer used, which closes their standard
+// input and kills them if they do not exit promptly.
+type PluginProvider struct {
+	// Logger receives the standard error output of the plugin. If nil, plugin
+	// output is discarded.
+	Logger *zap.Logger
+
+	path      string
+	editionID string
+
+	startOnce sync.Once
+	startErr  error
+	handshake pluginHandshake
+
+	closeOnce sync.Once
+	closeErr  error
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex     // Serializes writes to stdin
+	readers sync.WaitGroup // Read stdout and stderr until closed
+
+	mu      sync.Mutex // Guards fields below
+	nextID  uint64
+	pending map[uint64]chan pluginResponse
+	readErr error // Set once responses can no longer be read
+}
+
+type pluginHandshake struct {
+	ProtocolVersion int `json:"protocolVersion"`
+	Edition         struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"edition"`
+	DefaultVersion string `json:"defaultVersion"`
+}
+
+type pluginRequest struct {
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	Offline bool        `json:"offline,omitempty"`
+}
+
+type pluginResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+}
+
+type pluginVersionParams struct {
+	BaseDir string `json:"baseDir,omitempty"`
+	Version string `json:"version"`
+}
+
+type pluginRunParams struct {
+	BaseDir     string   `json:"baseDir"`
+	WorkingDir  string   `json:"workingDir"`
+	Version     string   `json:"version"`
+	RuntimeArgs []string `json:"runtimeArgs"`
+	ServerArgs  []string `json:"serverArgs"`
+}
+
+type pluginRunResult struct {
+	Path        string   `json:"path"`
+	Args        []string `json:"args"`
+	Env         []string `json:"env"`
+	Dir         string   `json:"dir"`
+	StopCommand string   `json:"stopCommand"`
+}
+
+const (
+	// Version of the plugin protocol implemented by PluginProvider
+	pluginProtocolVersion int = 1
+
+	// Prefix of plugin executable names, which is followed by the edition ID
+	PluginPrefix string = "mcl-provider-"
+)
+
+var (
+	// Duration within which plugins must respond to the handshake
+	pluginHandshakeTimeout = 10 * time.Second
+
+	// Duration to wait for plugins to exit once closed before killing them
+	pluginCloseTimeout = 5 * time.Second
+)
+
+// DiscoverPlugins searches directories, in order, for plugin executables named
+// mcl-provider-<edition> and returns a map mapping edition ID to the path of
+// its plugin. If several directories contain a plugin for the same edition,
+// the first is used. Nonexistent directories are ignored.
+func DiscoverPlugins(dirs []string) (map[string]string, error) {
+	plugins := make(map[string]string)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		fis, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, fi := range fis {
+			name := fi.Name()
+			if runtime.GOOS == "windows" {
+				if !strings.EqualFold(filepath.Ext(name), ".exe") {
+					continue
+				}
+				name = name[:len(name)-len(".exe")]
+			} else if fi.Mode()&0111 == 0 {
+				continue // Not executable
+			}
+			if fi.IsDir() || !strings.HasPrefix(name, PluginPrefix) || name == PluginPrefix {
+				continue
+			}
+
+			editionID := strings.TrimPrefix(name, PluginPrefix)
+			if _, ok := plugins[editionID]; !ok {
+				plugins[editionID] = filepath.Join(dir, fi.Name())
+			}
+		}
+	}
+	return plugins, nil
+}
+
+// NewPluginProvider creates a new PluginProvider for the plugin executable at
+// a path, providing an edition ID. The plugin is started on first use.
+func NewPluginProvider(path, editionID string) *PluginProvider {
+	return &PluginProvider{
+		path:      path,
+		editionID: editionID,
+	}
+}
+
+// start starts the plugin and performs the handshake if it has not already
+// been started. The handshake is abandoned once the context is done or the
+// handshake timeout elapses, and the plugin is closed.
+func (pp *PluginProvider) start(ctx context.Context) error {
+	pp.startOnce.Do(func() {
+		pp.startErr = pp.doStart(ctx)
+		if pp.startErr != nil {
+			pp.startErr = fmt.Errorf("plugin %s: %w", pp.path, pp.startErr)
+		}
+	})
+	return pp.startErr
+}
+
+func (pp *PluginProvider) doStart(ctx context.Context) error {
+	logger := pp.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	cmd := exec.Command(pp.path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pp.cmd = cmd
+	pp.stdin = stdin
+	pp.pending = make(map[uint64]chan pluginResponse)
+
+	pp.readers.Add(2)
+	go func() {
+		defer pp.readers.Done()
+		logLines(stderr, logger)
+	}()
+	go func() {
+		defer pp.readers.Done()
+		pp.readResponses(stdout)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, pluginHandshakeTimeout)
+	defer cancel()
+	if err := pp.call(ctx, "handshake", map[string]int{"protocolVersion": pluginProtocolVersion}, &pp.handshake); err != nil {
+		if ctx.Err() != nil {
+			cmd.Process.Kill() // The plugin is unresponsive
+		}
+		pp.Close()
+		if err == context.DeadlineExceeded {
+			return errors.New("plugin did not respond to the handshake")
+		}
+		return err
+	}
+	if pp.handshake.ProtocolVersion != pluginProtocolVersion {
+		pp.Close()
+		return fmt.Errorf("unsupported protocol version %d", pp.handshake.ProtocolVersion)
+	}
+	if pp.handshake.Edition.ID != pp.editionID {
+		pp.Close()
+		return fmt.Errorf("plugin provides edition %s instead of %s", pp.handshake.Edition.ID, pp.editionID)
+	}
+	return nil
+}
+
+// readResponses dispatches responses read from the plugin to their pending
+// requests until the plugin's standard output is closed.
+func (pp *PluginProvider) readResponses(r io.Reader) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024) // Responses may list many versions
+	for s.Scan() {
+		var res pluginResponse
+		if err := json.Unmarshal(s.Bytes(), &res); err != nil {
+			continue // Ignore malformed responses, as their request is unknown
+		}
+
+		pp.mu.Lock()
+		ch, ok := pp.pending[res.ID]
+		delete(pp.pending, res.ID)
+		pp.mu.Unlock()
+		if ok {
+			ch <- res
+		}
+	}
+
+	err := s.Err()
+	if err == nil {
+		err = errors.New("plugin exited")
+	}
+	pp.mu.Lock()
+	pp.readErr = err
+	for id, ch := range pp.pending {
+		ch <- pluginResponse{ID: id, Error: err.Error()}
+		delete(pp.pending, id)
+	}
+	pp.mu.Unlock()
+}
+
+func (pp *PluginProvider) send(req pluginRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	pp.writeMu.Lock()
+	defer pp.writeMu.Unlock()
+	_, err = pp.stdin.Write(append(b, '\n'))
+	return err
+}
+
+// call sends a request to the plugin and decodes the result of its response
+// into result, which may be nil if the result is unused.
+func (pp *PluginProvider) call(ctx context.Context, method string, params, result interface{}) error {
+	ch := make(chan pluginResponse, 1)
+	pp.mu.Lock()
+	if pp.readErr != nil {
+		pp.mu.Unlock()
+		return pp.readErr
+	}
+	pp.nextID++
+	id := pp.nextID
+	pp.pending[id] = ch
+	pp.mu.Unlock()
+
+	if err := pp.send(pluginRequest{ID: id, Method: method, Params: params, Offline: IsOffline(ctx)}); err != nil {
+		pp.mu.Lock()
+		delete(pp.pending, id)
+		pp.mu.Unlock()
+		return err
+	}
+
+	select {
+	case res := <-ch:
+		if res.Error != "" {
+			return errors.New(res.Error)
+		}
+		if result == nil || len(res.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(res.Result, result)
+	case <-ctx.Done():
+		pp.mu.Lock()
+		delete(pp.pending, id)
+		pp.mu.Unlock()
+		// Cancel the request on a best-effort basis without blocking on a plugin
+		// that does not read its input, which unblocks once the plugin is closed
+		go pp.send(pluginRequest{ID: id, Method: "cancel"})
+		return ctx.Err()
+	}
+}
+
+// Close closes the plugin's standard input and waits for it to exit, killing
+// it if it does not exit within the close timeout. Close has no effect if the
+// plugin was never started or was already closed.
+func (pp *PluginProvider) Close() error {
+	pp.closeOnce.Do(func() {
+		if pp.cmd == nil {
+			return
+		}
+		pp.stdin.Close()
+
+		// Read the plugin's output to EOF before waiting for it, as Wait closes
+		// the pipes being read
+		done := make(chan error, 1)
+		go func() {
+			pp.readers.Wait()
+			done <- pp.cmd.Wait()
+		}()
+		timer := time.NewTimer(pluginCloseTimeout)
+		defer timer.Stop()
+		select {
+		case pp.closeErr = <-done:
+		case <-timer.C:
+			pp.cmd.Process.Kill()
+			<-done
+			pp.closeErr = fmt.Errorf("plugin %s did not exit within %s and was killed", pp.path, pluginCloseTimeout)
+		}
+	})
+	return pp.closeErr
+}
+
+// startDetached starts the plugin for methods without a context, giving up once
+// the handshake timeout elapses.
+func (pp *PluginProvider) startDetached() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginHandshakeTimeout)
+	defer cancel()
+	return pp.start(ctx)
+}
+
+// Edition returns the edition ID and name provided by the plugin. The plugin is
+// started if necessary; if it fails to start, the edition ID is also returned
+// as its name.
+func (pp *PluginProvider) Edition() (id string, name string) {
+	if err := pp.startDetached(); err != nil || pp.handshake.Edition.Name == "" {
+		return pp.editionID, pp.editionID
+	}
+	return pp.editionID, pp.handshake.Edition.Name
+}
+
+// Versions returns all available server versions provided by the plugin.
+func (pp *PluginProvider) Versions(ctx context.Context) ([]string, error) {
+	if err := pp.start(ctx); err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Versions []string `json:"versions"`
+	}
+	if err := pp.call(ctx, "versions", struct{}{}, &result); err != nil {
+		return nil, err
+	}
+	return result.Versions, nil
+}
+
+// DefaultVersion returns the default version provided by the plugin. The
+// plugin is started if necessary; if it fails to start, "latest" is returned
+// and the failure is reported by subsequent calls.
+func (pp *PluginProvider) DefaultVersion() string {
+	if err := pp.startDetached(); err != nil || pp.handshake.DefaultVersion == "" {
+		return "latest"
+	}
+	return pp.handshake.DefaultVersion
+}
+
+// ResolveVersion resolves a version identifier to a fixed version identifier
+// through the plugin.
+func (pp *PluginProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	if err := pp.start(ctx); err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Version string `json:"version"`
+	}
+	if err := pp.call(ctx, "resolveVersion", pluginVersionParams{Version: version}, &result); err != nil {
+		return "", err
+	}
+	return result.Version, nil
+}
+
+// IsFetchNeeded returns whether the server resources for the edition and a
+// specified version require fetching through the plugin.
+func (pp *PluginProvider) IsFetchNeeded(ctx context.Context, baseDir, version string) (bool, error) {
+	return pp.isNeeded(ctx, "isFetchNeeded", baseDir, version)
+}
+
+// Fetch fetches (downloads) server resources into a specified base directory
+// through the plugin.
+func (pp *PluginProvider) Fetch(ctx context.Context, baseDir, version string) error {
+	return pp.do(ctx, "fetch", baseDir, version)
+}
+
+// IsPrepareNeeded returns whether the server resources for the edition and a
+// specified version require preparation through the plugin.
+func (pp *PluginProvider) IsPrepareNeeded(ctx context.Context, baseDir, version string) (bool, error) {
+	return pp.isNeeded(ctx, "isPrepareNeeded", baseDir, version)
+}
+
+// Prepare prepares (preprocesses) fetched server resources through the plugin.
+func (pp *PluginProvider) Prepare(ctx context.Context, baseDir, version string) error {
+	return pp.do(ctx, "prepare", baseDir, version)
+}
+
+func (pp *PluginProvider) isNeeded(ctx context.Context, method, baseDir, version string) (bool, error) {
+	if err := pp.start(ctx); err != nil {
+		return false, err
+	}
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return false, err
+	}
+
+	var result struct {
+		Needed bool `json:"needed"`
+	}
+	if err := pp.call(ctx, method, pluginVersionParams{BaseDir: baseDir, Version: version}, &result); err != nil {
+		return false, err
+	}
+	return result.Needed, nil
+}
+
+func (pp *PluginProvider) do(ctx context.Context, method, baseDir, version string) error {
+	if err := pp.start(ctx); err != nil {
+		return err
+	}
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+
+	return pp.call(ctx, method, pluginVersionParams{BaseDir: baseDir, Version: version}, nil)
+}
+
+// Run runs a server within a specified working directory using the command
+// returned by the plugin. Runtime and server arguments are passed to the
+// plugin, which determines how they are applied.
+func (pp *PluginProvider) Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error {
+	if err := pp.start(ctx); err != nil {
+		return err
+	}
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	workingDir, err = filepath.Abs(workingDir)
+	if err != nil {
+		return err
+	}
+
+	params := pluginRunParams{
+		BaseDir:     baseDir,
+		WorkingDir:  workingDir,
+		Version:     version,
+		RuntimeArgs: runtimeArgs,
+		ServerArgs:  serverArgs,
+	}
+	var result pluginRunResult
+	if err := pp.call(ctx, "run", params, &result); err != nil {
+		return err
+	}
+	if result.Path == "" {
+		return errors.New("plugin returned no command")
+	}
+
+	stopCommand := result.StopCommand
+	if stopCommand == "" {
+		stopCommand = serverStopCommand
+	}
+	cmd := exec.Command(result.Path, result.Args...)
+	cmd.Dir = workingDir
+	if result.Dir != "" {
+		cmd.Dir = result.Dir
+	}
+	cmd.Env = append(os.Environ(), result.Env...)
+	return runAttached(ctx, cmd, stopCommand)
+}
@@ -0,0 +1,223 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Environment variable that makes the test binary act as a stub plugin with
+// the behavior named by its value
+const stubPluginEnv string = "MCL_TEST_STUB_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if behavior := os.Getenv(stubPluginEnv); behavior != "" {
+		runStubPlugin(behavior)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runStubPlugin implements the plugin protocol for the edition "stub" over
+// the standard pipes. Behaviors other than "normal" misbehave: "silent" never
+// responds, "stubborn" does not exit once its input is closed, and "impostor"
+// provides another edition. Fetch requests are never answered, and
+// isFetchNeeded reports whether a request was cancelled.
+func runStubPlugin(behavior string) {
+	enc := json.NewEncoder(os.Stdout)
+	respond := func(id uint64, result interface{}, errMsg string) {
+		res := map[string]interface{}{"id": id}
+		if errMsg != "" {
+			res["error"] = errMsg
+		} else {
+			res["result"] = result
+		}
+		enc.Encode(res)
+	}
+
+	cancelled := false
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		var req struct {
+			ID     uint64          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(s.Bytes(), &req); err != nil {
+			fmt.Fprintln(os.Stderr, "malformed request:", err)
+			continue
+		}
+		if behavior == "silent" {
+			continue
+		}
+
+		switch req.Method {
+		case "handshake":
+			edition := "stub"
+			if behavior == "impostor" {
+				edition = "other"
+			}
+			respond(req.ID, map[string]interface{}{
+				"protocolVersion": 1,
+				"edition":         map[string]string{"id": edition, "name": "Stub"},
+				"defaultVersion":  "stable",
+			}, "")
+		case "versions":
+			respond(req.ID, map[string][]string{"versions": {"1.0", "1.1"}}, "")
+		case "resolveVersion":
+			var params pluginVersionParams
+			json.Unmarshal(req.Params, &params)
+			if params.Version == "stable" {
+				respond(req.ID, map[string]string{"version": "1.1"}, "")
+			} else {
+				respond(req.ID, nil, "version not found")
+			}
+		case "fetch":
+			// Never respond, such that the request must be cancelled
+		case "cancel":
+			cancelled = true
+		case "isFetchNeeded":
+			respond(req.ID, map[string]bool{"needed": cancelled}, "")
+		default:
+			respond(req.ID, nil, "unsupported method "+req.Method)
+		}
+	}
+
+	if behavior == "stubborn" {
+		time.Sleep(time.Minute)
+	}
+}
+
+// newStubPlugin returns a provider for the test binary acting as a stub plugin
+// with a behavior, which is closed once the test completes.
+func newStubPlugin(t *testing.T, behavior string) *PluginProvider {
+	t.Helper()
+	os.Setenv(stubPluginEnv, behavior)
+	t.Cleanup(func() { os.Unsetenv(stubPluginEnv) })
+
+	pp := NewPluginProvider(os.Args[0], "stub")
+	t.Cleanup(func() { pp.Close() })
+	return pp
+}
+
+// setPluginTimeouts shortens the plugin timeouts for the duration of a test.
+func setPluginTimeouts(t *testing.T, handshake, close time.Duration) {
+	prevHandshake, prevClose := pluginHandshakeTimeout, pluginCloseTimeout
+	pluginHandshakeTimeout, pluginCloseTimeout = handshake, close
+	t.Cleanup(func() {
+		pluginHandshakeTimeout, pluginCloseTimeout = prevHandshake, prevClose
+	})
+}
+
+func TestPluginRequests(t *testing.T) {
+	ctx := context.Background()
+	pp := newStubPlugin(t, "normal")
+
+	if id, name := pp.Edition(); id != "stub" || name != "Stub" {
+		t.Errorf("Edition() = %q, %q; want %q, %q", id, name, "stub", "Stub")
+	}
+	if got := pp.DefaultVersion(); got != "stable" {
+		t.Errorf("DefaultVersion() = %q, want %q", got, "stable")
+	}
+	versions, err := pp.Versions(ctx)
+	if want := []string{"1.0", "1.1"}; err != nil || !reflect.DeepEqual(versions, want) {
+		t.Errorf("Versions() = %q, %v; want %q, nil", versions, err, want)
+	}
+	if got, err := pp.ResolveVersion(ctx, "stable"); err != nil || got != "1.1" {
+		t.Errorf("ResolveVersion(%q) = %q, %v; want %q, nil", "stable", got, err, "1.1")
+	}
+	if _, err := pp.ResolveVersion(ctx, "unknown"); err == nil || err.Error() != "version not found" {
+		t.Errorf("ResolveVersion(%q) error = %v, want %q", "unknown", err, "version not found")
+	}
+	if err := pp.Prepare(ctx, tempDir(t), "1.1"); err == nil || !strings.Contains(err.Error(), "unsupported method") {
+		t.Errorf("Prepare error = %v, want unsupported method", err)
+	}
+
+	if err := pp.Close(); err != nil {
+		t.Errorf("Close error = %v", err)
+	}
+	if _, err := pp.Versions(ctx); err == nil {
+		t.Error("Versions after Close succeeded")
+	}
+}
+
+func TestPluginCancel(t *testing.T) {
+	pp := newStubPlugin(t, "normal")
+	baseDir := tempDir(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := pp.Fetch(ctx, baseDir, "1.1"); err != context.DeadlineExceeded {
+		t.Fatalf("Fetch error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The cancellation is sent asynchronously, and so may follow later requests
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		needed, err := pp.IsFetchNeeded(context.Background(), baseDir, "1.1")
+		if err != nil {
+			t.Fatalf("IsFetchNeeded error = %v", err)
+		}
+		if needed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("plugin did not receive the cancellation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPluginStartFailure(t *testing.T) {
+	setPluginTimeouts(t, 200*time.Millisecond, time.Second)
+	tests := []struct {
+		behavior string
+		wantErr  string
+	}{
+		{behavior: "silent", wantErr: "did not respond to the handshake"},
+		{behavior: "impostor", wantErr: "instead of stub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.behavior, func(t *testing.T) {
+			pp := newStubPlugin(t, tt.behavior)
+
+			// Methods without a context fall back to defaults within the timeout
+			start := time.Now()
+			if id, name := pp.Edition(); id != "stub" || name != "stub" {
+				t.Errorf("Edition() = %q, %q; want %q, %q", id, name, "stub", "stub")
+			}
+			if got := pp.DefaultVersion(); got != "latest" {
+				t.Errorf("DefaultVersion() = %q, want %q", got, "latest")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("starting the plugin took %s", elapsed)
+			}
+
+			if _, err := pp.Versions(context.Background()); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Versions error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPluginCloseTimeout(t *testing.T) {
+	setPluginTimeouts(t, 10*time.Second, 200*time.Millisecond)
+	pp := newStubPlugin(t, "stubborn")
+	if _, err := pp.Versions(context.Background()); err != nil {
+		t.Fatalf("Versions error = %v", err)
+	}
+
+	start := time.Now()
+	if err := pp.Close(); err == nil || !strings.Contains(err.Error(), "was killed") {
+		t.Errorf("Close error = %v, want killed", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close took %s", elapsed)
+	}
+}
@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Progress is a snapshot of the progress of a long-running operation, such as
+// downloading or extracting server resources.
+type Progress struct {
+	// Name briefly describes the operation (e.g. the name of the file being
+	// downloaded or of the program being run).
+	Name string
+
+	// BytesDone and BytesTotal are the number of bytes processed and the total
+	// number of bytes to process. BytesTotal is -1 if unknown. For programs run
+	// by providers (e.g. installers), the bytes processed are the output of the
+	// program.
+	BytesDone  int64
+	BytesTotal int64
+
+	// Rate is the average number of bytes processed per second.
+	Rate float64
+
+	// ETA is the estimated duration until the operation completes, or -1 if
+	// unknown.
+	ETA time.Duration
+
+	// Complete is whether the operation completed. It is only true for the final
+	// progress of each operation.
+	Complete bool
+
+	// Err is the error that stopped the operation, if it failed. It is only set
+	// for the final progress of an operation, along with Complete.
+	Err error
+}
+
+// ProgressObserver observes the progress of long-running operations performed
+// by providers. Observers may be notified concurrently by several operations.
+type ProgressObserver interface {
+	ObserveProgress(p Progress)
+}
+
+// ProgressFunc is an adapter to allow the use of an ordinary function as a
+// ProgressObserver.
+type ProgressFunc func(p Progress)
+
+// ObserveProgress calls f(p).
+func (f ProgressFunc) ObserveProgress(p Progress) {
+	f(p)
+}
+
+type progressKey struct{}
+
+// WithProgress returns a copy of a parent context in which providers report
+// the progress of operations during Fetch and Prepare to an observer.
+func WithProgress(parent context.Context, observer ProgressObserver) context.Context {
+	return context.WithValue(parent, progressKey{}, observer)
+}
+
+// progressObserver returns the observer for a context, or nil if there is
+// none.
+func progressObserver(ctx context.Context) ProgressObserver {
+	observer, _ := ctx.Value(progressKey{}).(ProgressObserver)
+	return observer
+}
+
+// Minimum interval between progress notifications for an operation
+const progressInterval time.Duration = 100 * time.Millisecond
+
+// progressTracker tracks the progress of an operation and notifies its
+// observer at most once per progress interval. A nil *progressTracker tracks
+// nothing, allowing operations to be tracked unconditionally.
+type progressTracker struct {
+	observer ProgressObserver
+	name     string
+
+	mu          sync.Mutex // Guards fields below
+	done        int64
+	total       int64
+	transferred int64 // Bytes processed since tracking started
+	start       time.Time
+	last        time.Time
+}
+
+// newProgressTracker returns a new tracker for an operation with a total number
+// of bytes, or nil if the context has no progress observer. The total may be
+// zero or negative if unknown.
+func newProgressTracker(ctx context.Context, name string, total int64) *progressTracker {
+	observer := progressObserver(ctx)
+	if observer == nil {
+		return nil
+	}
+	if total <= 0 {
+		total = -1
+	}
+	now := time.Now()
+	return &progressTracker{
+		observer: observer,
+		name:     name,
+		total:    total,
+		start:    now,
+		last:     now,
+	}
+}
+
+// set sets the number of bytes processed, and the total if known (i.e. greater
+// than zero), without counting them towards the rate.
+func (pt *progressTracker) set(done, total int64) {
+	if pt == nil {
+		return
+	}
+	pt.mu.Lock()
+	pt.done = done
+	if total > 0 {
+		pt.total = total
+	}
+	pt.mu.Unlock()
+}
+
+// add adds a number of processed bytes.
+func (pt *progressTracker) add(n int64) {
+	if pt == nil {
+		return
+	}
+	pt.mu.Lock()
+	pt.done += n
+	pt.transferred += n
+	now := time.Now()
+	if now.Sub(pt.last) < progressInterval {
+		pt.mu.Unlock()
+		return
+	}
+	pt.last = now
+	p := pt.progress(now)
+	pt.mu.Unlock()
+
+	pt.observer.ObserveProgress(p)
+}
+
+// finish notifies the observer that the operation completed, or failed if err
+// is non-nil.
+func (pt *progressTracker) finish(err error) {
+	if pt == nil {
+		return
+	}
+	pt.mu.Lock()
+	p := pt.progress(time.Now())
+	pt.mu.Unlock()
+
+	p.Complete = true
+	p.Err = err
+	if err == nil {
+		p.ETA = 0
+	} else {
+		p.ETA = -1
+	}
+	pt.observer.ObserveProgress(p)
+}
+
+func (pt *progressTracker) progress(now time.Time) Progress {
+	p := Progress{
+		Name:       pt.name,
+		BytesDone:  pt.done,
+		BytesTotal: pt.total,
+		ETA:        -1,
+	}
+	if elapsed := now.Sub(pt.start).Seconds(); elapsed > 0 {
+		p.Rate = float64(pt.transferred) / elapsed
+	}
+	if pt.total > 0 && p.Rate > 0 {
+		remaining := pt.total - pt.done
+		if remaining < 0 {
+			remaining = 0
+		}
+		p.ETA = time.Duration(float64(remaining) / p.Rate * float64(time.Second))
+	}
+	return p
+}
+
+// progressReader is an io.Reader that adds the bytes read from the underlying
+// reader to a progress tracker.
+type progressReader struct {
+	r  io.Reader
+	pt *progressTracker
+}
+
+func (pr progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.pt.add(int64(n))
+	return n, err
+}
@@ -51,6 +51,8 @@ type Provider interface {
 	// same base directory and for the same version. Runtime and server arguments
 	// may also be specified; however, runtime arguments may be ignored if the
 	// edition does not require a runtime environment (e.g. Java). Both argument
-	// parameters may be nil if no arguments need to be specified.
+	// parameters may be nil if no arguments need to be specified. Once the
+	// context is done, Run should stop the server gracefully, killing it if it
+	// does not stop within the stop timeout (see RunOptions).
 	Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error
 }
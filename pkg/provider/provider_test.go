@@ -0,0 +1,19 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// tempDir returns a new temporary directory, which is removed when the test
+// completes.
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "mcl-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// Console commands that stop servers gracefully, saving any worlds
+	serverStopCommand string = "stop"
+	proxyStopCommand  string = "end"
+)
+
+// DefaultStopTimeout is the default duration for which servers are given to
+// stop gracefully, which allows for saving worlds.
+const DefaultStopTimeout time.Duration = time.Minute
+
+// RunOptions contains options for running servers with Provider.Run.
+type RunOptions struct {
+	// StopTimeout is the duration for which a server is given to stop
+	// gracefully once the context of Run is done, after which it is killed. If
+	// zero, DefaultStopTimeout is used; if negative, the server is killed
+	// immediately.
+	StopTimeout time.Duration
+
+	// Kill, if non-nil, kills a server stopping gracefully once closed (e.g. on
+	// a repeated interrupt) without waiting for the stop timeout.
+	Kill <-chan struct{}
+
+	// Send, if non-nil, sends a command to the server's standard input (e.g.
+	// through a console multiplexer that serializes commands from several
+	// sources). It is used to send the stop command. If nil, commands are
+	// written to the server's standard input directly.
+	Send func(command string) error
+
+	// Stdin, Stdout, and Stderr are the standard pipes of the server (e.g. of a
+	// console multiplexer). If nil, those of the current process are used.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+type runOptionsKey struct{}
+
+// WithRunOptions returns a copy of a parent context in which providers run
+// servers according to options.
+func WithRunOptions(parent context.Context, opts RunOptions) context.Context {
+	return context.WithValue(parent, runOptionsKey{}, opts)
+}
+
+// runOptions returns the run options for a context, with defaults applied.
+func runOptions(ctx context.Context) RunOptions {
+	opts, _ := ctx.Value(runOptionsKey{}).(RunOptions)
+	if opts.StopTimeout == 0 {
+		opts.StopTimeout = DefaultStopTimeout
+	}
+	if opts.Stdin == nil {
+		opts.Stdin = os.Stdin
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	return opts
+}
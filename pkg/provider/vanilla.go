@@ -1,24 +1,45 @@
 package provider
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha1"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
-	"io"
-	"net/http"
-	"os"
-	"os/exec"
+	"hash"
+	"net/url"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
 // JavaProvider is a provider for Minecraft: Java Edition provided by Mojang.
 type JavaProvider struct {
-	versions   []javaVersionInfo
-	versionMap map[string]*javaVersionInfo // Maps version ID to version info
+	// LauncherManifestURL is the URL of the launcher manifest. If empty, the
+	// launcher manifest provided by Mojang is used.
+	LauncherManifestURL string
+
+	// MirrorURL is the base URL of a mirror of the resources provided by Mojang
+	// (e.g. an Artifactory remote repository or a static file server). If
+	// non-empty, each URL with a hostname of Mojang is requested from the mirror
+	// by appending its hostname and path to the base URL (e.g.
+	// https://mirror.example.com/launcher.mojang.com/v1/objects/...), falling
+	// back to the URL itself if the request to the mirror fails.
+	MirrorURL string
+
+	// AcceptedHostnames restricts the hostnames that the provider may request,
+	// including those of URLs listed by manifests and of redirects, to those
+	// listed and their subdomains (see AnyHostname). The hostnames of the
+	// launcher manifest and mirror URLs are always accepted. If empty, only the
+	// hostnames of Mojang are accepted.
+	AcceptedHostnames []string
+
+	// Cache, if non-nil, persistently caches the launcher and version manifests
+	// provided by Mojang.
+	Cache *ManifestCache
+
+	versions      []javaVersionInfo
+	versionMap    map[string]*javaVersionInfo // Maps version ID to version info
+	legacyFetched bool                        // Whether legacy versions were merged
 }
 
 type javaVersionInfo struct {
@@ -41,32 +62,85 @@ const (
 	// URL of the launcher manifest provided by Mojang
 	launcherManifestURL string = "https://launchermeta.mojang.com/mc/game/version_manifest.json"
 
+	// Base URL of the legacy version endpoint provided by Mojang, which serves
+	// server JARs for versions prior to 1.2.5
+	legacyVersionsURL string = "https://s3.amazonaws.com/Minecraft.Download/versions/"
+
 	// Filename of the server JAR
 	serverJARFilename string = "server.jar"
 )
 
-func isAcceptedHostname(rawurl string, acceptedHostnames []string) bool {
-	return true
+// javaAcceptedHostnames are the hostnames accepted by default for Minecraft:
+// Java Edition, which are those used by Mojang for the launcher manifest,
+// version manifests, and server JARs. Of the shared S3 hostname, only the
+// legacy version endpoint is accepted.
+var javaAcceptedHostnames = []string{
+	"mojang.com",
+	"minecraft.net",
+	legacyVersionsURL,
 }
 
-func (jp *JavaProvider) fetchManifest(ctx context.Context, force bool) error {
-	if force || jp.versions == nil {
-		// Download and parse the JSON launcher manifest
-		req, err := http.NewRequest(http.MethodGet, launcherManifestURL, nil) // TODO: Test for accepted hostnames
-		if err != nil {
+func (jp *JavaProvider) restrictHostnames(ctx context.Context) context.Context {
+	if len(jp.AcceptedHostnames) == 0 {
+		return restrictHostnames(ctx, javaAcceptedHostnames, jp.LauncherManifestURL, jp.MirrorURL)
+	}
+	return restrictHostnames(ctx, jp.AcceptedHostnames, jp.LauncherManifestURL, jp.MirrorURL)
+}
+
+func (jp *JavaProvider) launcherManifestURL() string {
+	if jp.LauncherManifestURL == "" {
+		return launcherManifestURL
+	}
+	return jp.LauncherManifestURL
+}
+
+// mirrorURL returns the URL of a resource on the mirror, or an empty string if
+// there is no mirror or the resource is not provided by Mojang.
+func (jp *JavaProvider) mirrorURL(rawurl string) string {
+	if jp.MirrorURL == "" || !isAcceptedHostname(rawurl, javaAcceptedHostnames) {
+		return ""
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	mirrorURL := strings.TrimSuffix(jp.MirrorURL, "/") + "/" + u.Host + u.EscapedPath()
+	if u.RawQuery != "" {
+		mirrorURL += "?" + u.RawQuery
+	}
+	return mirrorURL
+}
+
+// getJSON downloads and parses the JSON manifest at a URL using the cache,
+// preferring the mirror if any.
+func (jp *JavaProvider) getJSON(ctx context.Context, rawurl string, v interface{}) error {
+	if mirrorURL := jp.mirrorURL(rawurl); mirrorURL != "" {
+		if err := jp.Cache.getJSON(ctx, mirrorURL, v); err == nil || ctx.Err() != nil {
 			return err
 		}
-		req = req.WithContext(ctx)
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
+	}
+	return jp.Cache.getJSON(ctx, rawurl, v)
+}
+
+// downloadVerifiedFile downloads the resource at a URL to a file as the
+// package-level downloadVerifiedFile does, preferring the mirror if any.
+func (jp *JavaProvider) downloadVerifiedFile(ctx context.Context, rawurl, path string, h hash.Hash, expectedHex string, size int64) error {
+	if mirrorURL := jp.mirrorURL(rawurl); mirrorURL != "" {
+		if err := downloadVerifiedFile(ctx, mirrorURL, path, h, expectedHex, size); err == nil || ctx.Err() != nil {
 			return err
 		}
+	}
+	return downloadVerifiedFile(ctx, rawurl, path, h, expectedHex, size)
+}
 
+func (jp *JavaProvider) fetchManifest(ctx context.Context, force bool) error {
+	if force || jp.versions == nil {
+		// Download and parse the JSON launcher manifest
 		var launcherManifest struct {
 			Latest   map[string]string `json:"latest"`
 			Versions []javaVersionInfo `json:"versions"`
 		}
-		if err := json.NewDecoder(res.Body).Decode(&launcherManifest); err != nil {
+		if err := jp.getJSON(ctx, jp.launcherManifestURL(), &launcherManifest); err != nil {
 			return err
 		}
 
@@ -89,34 +163,118 @@ func (jp *JavaProvider) fetchManifest(ctx context.Context, force bool) error {
 	return nil
 }
 
-func (jvi *javaVersionInfo) fetchVersionManifest(ctx context.Context, force bool) (*javaVersionResource, error) {
-	if force || jvi.versionResource == nil {
-		// Download and parse JSON version manifest
-		req, err := http.NewRequest(http.MethodGet, jvi.URL, nil) // TODO: Test for accepted hostnames
-		if err != nil {
-			return nil, err
+// fetchLegacyManifest merges versions listed by the legacy version endpoint
+// that are absent from the launcher manifest into the cached versions. The
+// launcher manifest must have been previously fetched.
+func (jp *JavaProvider) fetchLegacyManifest(ctx context.Context, force bool) error {
+	if force || !jp.legacyFetched {
+		var legacyManifest struct {
+			Versions []javaVersionInfo `json:"versions"`
 		}
-		req = req.WithContext(ctx)
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
+		if err := jp.getJSON(ctx, legacyVersionsURL+"versions.json", &legacyManifest); err != nil {
+			return err
 		}
-		defer res.Body.Close()
 
-		var versionManifest struct {
-			Downloads struct {
-				Server javaVersionResource `json:"server"`
+		// Legacy versions have no URL in the legacy manifest, so they reference
+		// their version manifest on the legacy endpoint instead.
+		versions := jp.versions
+		for _, vInfo := range legacyManifest.Versions {
+			if _, ok := jp.versionMap[vInfo.ID]; !ok {
+				vInfo.URL = legacyVersionManifestURL(vInfo.ID)
+				versions = append(versions, vInfo)
+			}
+		}
+		sort.SliceStable(versions, func(i, j int) bool { // Newest first, as in the launcher manifest
+			return versions[i].ReleaseTime.After(versions[j].ReleaseTime)
+		})
+
+		// Re-index versions, retaining aliases to their new locations
+		aliases := make(map[string]string)
+		for alias, vInfo := range jp.versionMap {
+			if alias != vInfo.ID {
+				aliases[alias] = vInfo.ID
+			}
+		}
+		jp.versions = versions
+		jp.versionMap = make(map[string]*javaVersionInfo)
+		for i, vInfo := range versions {
+			jp.versionMap[vInfo.ID] = &versions[i]
+		}
+		for alias, version := range aliases {
+			jp.versionMap[alias] = jp.versionMap[version]
+		}
+		jp.legacyFetched = true
+	}
 
-				// ...unused fields for client resources...
-			} `json:"downloads"`
+	return nil
+}
 
-			// ...other unused fields...
+// lookupVersion returns the version info for a version identifier, falling
+// back to versions listed by the legacy version endpoint if it is not in the
+// launcher manifest. The launcher manifest must have been previously fetched.
+func (jp *JavaProvider) lookupVersion(ctx context.Context, version string) (*javaVersionInfo, error) {
+	if vInfo, ok := jp.versionMap[version]; ok {
+		return vInfo, nil
+	}
+	if !jp.legacyFetched {
+		if err := jp.fetchLegacyManifest(ctx, false); err != nil {
+			return nil, err
 		}
-		if err := json.NewDecoder(res.Body).Decode(&versionManifest); err != nil {
+		if vInfo, ok := jp.versionMap[version]; ok {
+			return vInfo, nil
+		}
+	}
+	return nil, errors.New("version not found")
+}
+
+func legacyVersionManifestURL(version string) string {
+	return legacyVersionsURL + version + "/" + version + ".json"
+}
+
+func legacyServerJARURL(version string) string {
+	return legacyVersionsURL + version + "/minecraft_server." + version + ".jar"
+}
+
+// fetchServerResource downloads and parses a version manifest, returning its
+// server resource. The resource URL is empty if the version manifest lists no
+// server.
+func (jp *JavaProvider) fetchServerResource(ctx context.Context, rawurl string) (*javaVersionResource, error) {
+	var versionManifest struct {
+		Downloads struct {
+			Server javaVersionResource `json:"server"`
+
+			// ...unused fields for client resources...
+		} `json:"downloads"`
+
+		// ...other unused fields...
+	}
+	if err := jp.getJSON(ctx, rawurl, &versionManifest); err != nil {
+		return nil, err
+	}
+	return &versionManifest.Downloads.Server, nil // We only need to track the server resource
+}
+
+func (jvi *javaVersionInfo) fetchVersionManifest(ctx context.Context, jp *JavaProvider, force bool) (*javaVersionResource, error) {
+	if force || jvi.versionResource == nil {
+		vResource, err := jp.fetchServerResource(ctx, jvi.URL)
+		if err != nil {
 			return nil, err
 		}
 
-		jvi.versionResource = &versionManifest.Downloads.Server // We only need to track the server resource
+		// The launcher manifest lists no servers prior to 1.2.5; however, they
+		// are available through the legacy version endpoint without checksums.
+		if vResource.URL == "" {
+			if legacyURL := legacyVersionManifestURL(jvi.ID); jvi.URL != legacyURL {
+				if vResource, err = jp.fetchServerResource(ctx, legacyURL); err != nil {
+					return nil, err
+				}
+			}
+			if vResource.URL == "" {
+				vResource.URL = legacyServerJARURL(jvi.ID)
+			}
+		}
+
+		jvi.versionResource = vResource
 	}
 
 	return jvi.versionResource, nil
@@ -135,22 +293,28 @@ func (JavaProvider) Edition() (id string, name string) {
 // Minecraft: Java Edition, it also returns channels, such as "release" and
 // "snapshot".
 func (jp *JavaProvider) Versions(ctx context.Context) ([]string, error) {
+	ctx = jp.restrictHostnames(ctx)
 	if err := jp.fetchManifest(ctx, false); err != nil {
 		return nil, err
 	}
 
-	// Determine release time cutoff for supported versions. The version manifest
-	// returns server JAR as far back as 1.2.5; however, servers are available for
-	// older versions through a different endpoint.
-	// TODO: Support versions available through http://s3.amazonaws.com/Minecraft.Download/versions/<VERSION>/<VERSION>.json
+	// Merge versions only available through the legacy version endpoint. As
+	// they are supplementary, versions are still listed if the legacy endpoint
+	// is unavailable.
+	_ = jp.fetchLegacyManifest(ctx, false)
+
+	// Determine release time cutoff for versions available through the launcher
+	// manifest. The launcher manifest returns server JARs as far back as 1.2.5;
+	// however, the legacy version endpoint also provides servers for earlier
+	// releases (but not snapshots, betas, or alphas).
 	jvi125, ok := jp.versionMap["1.2.5"]
 	if !ok {
-		return nil, errors.New("version 1.2.5 not found (oldest supported server)")
+		return nil, errors.New("version 1.2.5 not found")
 	}
 
 	versionIDs := make([]string, 0)
 	for _, vInfo := range jp.versions {
-		if vInfo.ReleaseTime.After(jvi125.ReleaseTime) || vInfo.ReleaseTime.Equal(jvi125.ReleaseTime) { // Filter unsupported versions prior to 1.2.5
+		if !vInfo.ReleaseTime.Before(jvi125.ReleaseTime) || vInfo.Type == "release" { // Filter unsupported versions prior to 1.2.5
 			versionIDs = append(versionIDs, vInfo.ID)
 		}
 	}
@@ -166,13 +330,14 @@ func (JavaProvider) DefaultVersion() string {
 // ResolveVersion resolves a version identifier to a fixed version
 // identifier (e.g. release -> 1.7).
 func (jp *JavaProvider) ResolveVersion(ctx context.Context, version string) (string, error) {
+	ctx = jp.restrictHostnames(ctx)
 	if err := jp.fetchManifest(ctx, false); err != nil {
 		return "", err
 	}
 
-	vInfo, ok := jp.versionMap[version]
-	if !ok {
-		return "", errors.New("version not found")
+	vInfo, err := jp.lookupVersion(ctx, version)
+	if err != nil {
+		return "", err
 	}
 	return vInfo.ID, nil
 }
@@ -182,80 +347,63 @@ func (jp *JavaProvider) ResolveVersion(ctx context.Context, version string) (str
 // Minecraft: Java Edition, it checks if the server JAR exists locally, and if
 // so, compares the SHA-1 checksum with that provided by Mojang.
 func (jp *JavaProvider) IsFetchNeeded(ctx context.Context, baseDir, version string) (bool, error) {
+	ctx = jp.restrictHostnames(ctx)
 	if err := jp.fetchManifest(ctx, false); err != nil {
 		return false, err
 	}
 
 	// Get and extract the hash for the server from the version manifest.
-	vInfo, ok := jp.versionMap[version]
-	if !ok {
-		return false, errors.New("version not found")
-	}
-	vResource, err := vInfo.fetchVersionManifest(ctx, false)
+	vInfo, err := jp.lookupVersion(ctx, version)
 	if err != nil {
 		return false, err
 	}
-
-	expectedSHA1, err := hex.DecodeString(vResource.SHA1)
+	vResource, err := vInfo.fetchVersionManifest(ctx, jp, false)
 	if err != nil {
-		return false, nil
+		return false, err
 	}
 
-	// Determine the hash of the JAR file available locally (if one exists)
+	// Legacy servers have no checksum, so only their existence is checked
 	// TODO: Do this in parallel with fetching the version manifest
 	jarPath := jp.jarPath(baseDir)
-	jarFile, err := os.Open(jarPath)
-	if err != nil {
-		return true, nil // TODO: Check existence first
+	if vResource.SHA1 == "" {
+		exists, err := fileExists(jarPath)
+		return !exists, err
 	}
-	defer jarFile.Close()
-
-	h := sha1.New()
-	if _, err := io.Copy(h, jarFile); err != nil {
+	ok, err := fileHashMatches(jarPath, sha1.New(), vResource.SHA1)
+	if err != nil {
 		return false, err
 	}
-
-	// Return whether the hashes are equal
-	return !bytes.Equal(h.Sum(nil), expectedSHA1), nil
+	return !ok, nil
 }
 
 // Fetch fetches (downloads) server resources into a specified base directory.
 // For Minecraft: Java Edition, it downloads the server JAR from Mojang to the
-// base directory.
+// base directory. The server JAR is only replaced once it is fully downloaded
+// and verified against the SHA-1 checksum and size provided by Mojang.
 func (jp *JavaProvider) Fetch(ctx context.Context, baseDir, version string) error {
+	ctx = jp.restrictHostnames(ctx)
 	if err := jp.fetchManifest(ctx, false); err != nil {
 		return err
 	}
 
 	// Download and parse the version manifest
-	vInfo, ok := jp.versionMap[version]
-	if !ok {
-		return errors.New("version not found")
-	}
-	vResource, err := vInfo.fetchVersionManifest(ctx, false)
+	vInfo, err := jp.lookupVersion(ctx, version)
 	if err != nil {
 		return err
 	}
-
-	// Create/open server JAR file
-	if err := os.MkdirAll(baseDir, os.ModeDir|0755); err != nil {
-		return err
-	}
-	jarPath := jp.jarPath(baseDir)
-	jarFile, err := os.OpenFile(jarPath, os.O_RDWR|os.O_CREATE, 0644)
+	vResource, err := vInfo.fetchVersionManifest(ctx, jp, false)
 	if err != nil {
 		return err
 	}
 
-	// Download the server JAR from the URL specified by the verison manifest.
-	res, err := http.Get(vResource.URL) // TODO: Utilize context
-	if err != nil {
-		return err
+	// Download the server JAR from the URL specified by the version manifest,
+	// verifying it against its checksum and size if available. Legacy servers
+	// have neither.
+	var h hash.Hash
+	if vResource.SHA1 != "" {
+		h = sha1.New()
 	}
-	defer res.Body.Close()
-	io.Copy(jarFile, res.Body) // TODO: Check for error
-
-	return nil
+	return jp.downloadVerifiedFile(ctx, vResource.URL, jp.jarPath(baseDir), h, vResource.SHA1, vResource.Size)
 }
 
 // IsPrepareNeeded returns whether the server resources for the edition and a
@@ -279,23 +427,5 @@ func (jp *JavaProvider) Prepare(_ context.Context, _, _ string) error {
 // options and server arguments are passed to the server JAR. Either argument
 // parameter may be nil if no arguments need to be specified.
 func (jp *JavaProvider) Run(ctx context.Context, baseDir, workingDir, version string, runtimeArgs, serverArgs []string) error {
-	jarPath, err := filepath.Abs(jp.jarPath(baseDir))
-	if err != nil {
-		return err
-	}
-
-	// Concatenate arguments
-	args := append(runtimeArgs, "-jar", jarPath)
-	if serverArgs != nil {
-		args = append(args, serverArgs...)
-	}
-	cmd := exec.CommandContext(ctx, "java", args...) // TODO: Shutdown gracefully instead of kill when context cancelled
-	cmd.Dir = workingDir
-
-	// Java server may use all standard pipes
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+	return runJAR(ctx, jp.jarPath(baseDir), workingDir, runtimeArgs, serverArgs, serverStopCommand)
 }
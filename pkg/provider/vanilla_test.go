@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mojangResources returns the resources provided by Mojang for a single
+// version, keyed by hostname and path, whose server JAR is body.
+func mojangResources(body string) map[string][]byte {
+	sum := sha1.Sum([]byte(body))
+	serverURL := "https://launcher.mojang.com/v1/objects/" + hex.EncodeToString(sum[:]) + "/server.jar"
+	versionURL := "https://launchermeta.mojang.com/v1/packages/0/1.16.5.json"
+	launcherManifest, _ := json.Marshal(map[string]interface{}{
+		"latest": map[string]string{"release": "1.16.5"},
+		"versions": []map[string]string{
+			{"id": "1.16.5", "type": "release", "url": versionURL},
+		},
+	})
+	versionManifest, _ := json.Marshal(map[string]interface{}{
+		"downloads": map[string]interface{}{
+			"server": map[string]interface{}{
+				"sha1": hex.EncodeToString(sum[:]),
+				"size": len(body),
+				"url":  serverURL,
+			},
+		},
+	})
+	return map[string][]byte{
+		strings.TrimPrefix(launcherManifestURL, "https://"): launcherManifest,
+		strings.TrimPrefix(versionURL, "https://"):          versionManifest,
+		strings.TrimPrefix(serverURL, "https://"):           []byte(body),
+	}
+}
+
+// resourceServer serves resources keyed by hostname and path, recording the
+// keys of the resources requested.
+type resourceServer struct {
+	resources map[string][]byte
+	key       func(r *http.Request) string
+
+	mu        sync.Mutex
+	requested []string
+}
+
+func (rs *resourceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := rs.key(r)
+	rs.mu.Lock()
+	rs.requested = append(rs.requested, key)
+	rs.mu.Unlock()
+	if b, ok := rs.resources[key]; ok {
+		w.Write(b)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// requestedFiles returns the base names of the resources requested, sorted.
+func (rs *resourceServer) requestedFiles() []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	files := make([]string, 0, len(rs.requested))
+	for _, key := range rs.requested {
+		files = append(files, filepath.Base(key))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// withMojangServer returns a copy of a parent context whose HTTP client sends
+// requests for the hostnames of Mojang to a stand-in TLS server.
+func withMojangServer(t *testing.T, parent context.Context, rs *resourceServer) context.Context {
+	t.Helper()
+	rs.key = func(r *http.Request) string { return r.Host + r.URL.Path }
+	srv := httptest.NewTLSServer(rs)
+	t.Cleanup(srv.Close)
+
+	var d net.Dialer
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if host, _, _ := net.SplitHostPort(addr); isAcceptedHostname("https://"+host, javaAcceptedHostnames) {
+					addr = srv.Listener.Addr().String()
+				}
+				return d.DialContext(ctx, network, addr)
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	return WithHTTPClient(parent, client)
+}
+
+func TestJavaMirrorFallback(t *testing.T) {
+	const body = "server"
+	tests := []struct {
+		name         string
+		mirror       map[string][]byte // Resources on the mirror
+		wantMirrored []string          // Resources requested from the mirror
+		wantOrigin   []string          // Resources requested from Mojang
+	}{
+		{
+			name:         "mirror serves all",
+			mirror:       mojangResources(body),
+			wantMirrored: []string{"1.16.5.json", "server.jar", "version_manifest.json"},
+			wantOrigin:   []string{},
+		},
+		{
+			name: "mirror lacks server JAR",
+			mirror: func() map[string][]byte {
+				m := mojangResources(body)
+				for key := range m {
+					if strings.HasSuffix(key, "/server.jar") {
+						delete(m, key)
+					}
+				}
+				return m
+			}(),
+			wantMirrored: []string{"1.16.5.json", "server.jar", "version_manifest.json"},
+			wantOrigin:   []string{"server.jar"},
+		},
+		{
+			name: "mirror serves tampered server JAR",
+			mirror: func() map[string][]byte {
+				m := mojangResources(body)
+				for key := range m {
+					if strings.HasSuffix(key, "/server.jar") {
+						m[key] = []byte("tamper")
+					}
+				}
+				return m
+			}(),
+			wantMirrored: []string{"1.16.5.json", "server.jar", "version_manifest.json"},
+			wantOrigin:   []string{"server.jar"},
+		},
+		{
+			name:         "mirror serves none",
+			mirror:       map[string][]byte{},
+			wantMirrored: []string{"1.16.5.json", "server.jar", "version_manifest.json"},
+			wantOrigin:   []string{"1.16.5.json", "server.jar", "version_manifest.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := &resourceServer{resources: mojangResources(body)}
+			ctx := withMojangServer(t, context.Background(), origin)
+
+			mirror := &resourceServer{
+				resources: tt.mirror,
+				key:       func(r *http.Request) string { return strings.TrimPrefix(r.URL.Path, "/") },
+			}
+			mirrorSrv := httptest.NewServer(mirror)
+			t.Cleanup(mirrorSrv.Close)
+
+			jp := &JavaProvider{MirrorURL: mirrorSrv.URL}
+			baseDir := tempDir(t)
+			if err := jp.Fetch(ctx, baseDir, "release"); err != nil {
+				t.Fatalf("Fetch error = %v", err)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(baseDir, serverJARFilename))
+			if err != nil || string(b) != body {
+				t.Errorf("server JAR = %q, %v; want %q", b, err, body)
+			}
+			if got := mirror.requestedFiles(); !reflect.DeepEqual(got, tt.wantMirrored) {
+				t.Errorf("requested from mirror = %q, want %q", got, tt.wantMirrored)
+			}
+			if got := origin.requestedFiles(); !reflect.DeepEqual(got, tt.wantOrigin) {
+				t.Errorf("requested from Mojang = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packet types of the Source RCON protocol
+const (
+	typeResponseValue int32 = 0
+	typeExecCommand   int32 = 2
+	typeAuthResponse  int32 = 2
+	typeAuth          int32 = 3
+)
+
+const (
+	// Port on which servers listen for RCON by default
+	DefaultPort int = 25575
+
+	// Maximum length of a command accepted by Minecraft: Java Edition servers
+	MaxCommandLength int = 1446
+
+	// Maximum length of a packet read from servers, excluding its length
+	// field, which guards against invalid lengths. Minecraft: Java Edition
+	// servers split responses into packets with bodies of at most 4096 bytes.
+	maxPacketLength int32 = 1 << 20
+
+	// Length of a packet excluding its body, not including the length field
+	packetHeaderLength int32 = 10
+)
+
+// ErrAuthFailed is returned when the server rejects authentication (e.g. due
+// to an incorrect password).
+var ErrAuthFailed = errors.New("authentication failed")
+
+// Client is a client for the Source RCON protocol, as implemented by
+// Minecraft: Java Edition servers. Commands are executed one at a time; a
+// Client is safe for concurrent use.
+type Client struct {
+	conn    net.Conn
+	timeout time.Duration
+
+	mu     sync.Mutex // Guards fields below
+	nextID int32
+}
+
+// Dial connects to the RCON server at an address (e.g. localhost:25575) and
+// authenticates with a password. The timeout applies to connecting and to
+// each subsequent command; if zero, there is no timeout.
+func Dial(address, password string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:    conn,
+		timeout: timeout,
+		nextID:  1,
+	}
+	if err := c.auth(password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// auth authenticates with the server.
+func (c *Client) auth(password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setDeadline()
+
+	id := c.newID()
+	if err := c.writePacket(id, typeAuth, password); err != nil {
+		return err
+	}
+	for {
+		respID, respType, _, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if respType != typeAuthResponse {
+			continue // Some servers precede the response with an empty value
+		}
+		if respID == -1 {
+			return ErrAuthFailed
+		} else if respID != id {
+			return fmt.Errorf("unexpected response ID %d to authentication", respID)
+		}
+		return nil
+	}
+}
+
+// Command executes a command on the server and returns its response.
+// Responses split across several packets are reassembled by following the
+// command with an empty packet, which the server only responds to once the
+// response to the command is complete. Minecraft: Java Edition servers drop
+// connections on which both packets are read at once, so the empty packet is
+// only sent once the first packet of the response is received.
+func (c *Client) Command(command string) (string, error) {
+	if len(command) > MaxCommandLength {
+		return "", fmt.Errorf("command exceeds maximum length of %d bytes", MaxCommandLength)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setDeadline()
+
+	id := c.newID()
+	if err := c.writePacket(id, typeExecCommand, command); err != nil {
+		return "", err
+	}
+
+	var response bytes.Buffer
+	var endID int32 // Zero until the empty packet is sent, as IDs are positive
+	for {
+		respID, respType, body, err := c.readPacket()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case endID != 0 && respID == endID:
+			return response.String(), nil
+		case respID == id && respType == typeResponseValue:
+			response.Write(body)
+			if endID == 0 {
+				endID = c.newID()
+				if err := c.writePacket(endID, typeResponseValue, ""); err != nil {
+					return "", err
+				}
+			}
+		case respID == -1:
+			return "", ErrAuthFailed
+		}
+	}
+}
+
+// newID returns a new request ID, which is always positive.
+func (c *Client) newID() int32 {
+	id := c.nextID
+	c.nextID++
+	if c.nextID <= 0 {
+		c.nextID = 1
+	}
+	return id
+}
+
+// setDeadline sets the deadline of the connection for an operation.
+func (c *Client) setDeadline() {
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	} else {
+		c.conn.SetDeadline(time.Time{})
+	}
+}
+
+// writePacket writes a packet to the server.
+func (c *Client) writePacket(id, packetType int32, body string) error {
+	length := packetHeaderLength + int32(len(body))
+	b := make([]byte, 4+length)
+	binary.LittleEndian.PutUint32(b[0:], uint32(length))
+	binary.LittleEndian.PutUint32(b[4:], uint32(id))
+	binary.LittleEndian.PutUint32(b[8:], uint32(packetType))
+	copy(b[12:], body) // Followed by the body and padding terminators
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// readPacket reads a packet from the server.
+func (c *Client) readPacket() (id, packetType int32, body []byte, err error) {
+	var header [12]byte
+	if _, err := io.ReadFull(c.conn, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	length := int32(binary.LittleEndian.Uint32(header[0:]))
+	id = int32(binary.LittleEndian.Uint32(header[4:]))
+	packetType = int32(binary.LittleEndian.Uint32(header[8:]))
+	if length < packetHeaderLength || length > maxPacketLength {
+		return 0, 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+
+	b := make([]byte, length-8)
+	if _, err := io.ReadFull(c.conn, b); err != nil {
+		return 0, 0, nil, err
+	}
+	return id, packetType, b[:len(b)-2], nil // Strip the terminators
+}
@@ -0,0 +1,135 @@
+package rcon
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Maximum body length of packets written by Minecraft: Java Edition servers
+const maxResponseBodyLength int = 4096
+
+// fakeServer is a stand-in for the RCON server of Minecraft: Java Edition,
+// which responds to each command with its response repeated, split into
+// packets of at most 4096 bytes. Like Minecraft, it drops connections on which
+// another packet is received before it responds to a command.
+type fakeServer struct {
+	l        net.Listener
+	password string
+	repeat   int
+}
+
+func newFakeServer(t *testing.T, password string, repeat int) *fakeServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	fs := &fakeServer{l: l, password: password, repeat: repeat}
+	go fs.serve()
+	return fs
+}
+
+func (fs *fakeServer) serve() {
+	for {
+		conn, err := fs.l.Accept()
+		if err != nil {
+			return
+		}
+		go fs.handle(conn)
+	}
+}
+
+func (fs *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		id, packetType, body, err := readTestPacket(conn)
+		if err != nil {
+			return
+		}
+		switch packetType {
+		case typeAuth:
+			if body != fs.password {
+				id = -1
+			}
+			writeTestPacket(conn, id, typeAuthResponse, "")
+		case typeExecCommand:
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				return // Read with the command, so drop the connection
+			}
+			conn.SetReadDeadline(time.Time{})
+			response := strings.Repeat(body, fs.repeat)
+			for len(response) > maxResponseBodyLength {
+				writeTestPacket(conn, id, typeResponseValue, response[:maxResponseBodyLength])
+				response = response[maxResponseBodyLength:]
+			}
+			writeTestPacket(conn, id, typeResponseValue, response)
+		default:
+			writeTestPacket(conn, id, typeResponseValue, "Unknown request 0")
+		}
+	}
+}
+
+func readTestPacket(r io.Reader) (id, packetType int32, body string, err error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, "", err
+	}
+	b := make([]byte, binary.LittleEndian.Uint32(header[0:])-8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, 0, "", err
+	}
+	id = int32(binary.LittleEndian.Uint32(header[4:]))
+	packetType = int32(binary.LittleEndian.Uint32(header[8:]))
+	return id, packetType, string(b[:len(b)-2]), nil
+}
+
+func writeTestPacket(w io.Writer, id, packetType int32, body string) {
+	b := make([]byte, 14+len(body))
+	binary.LittleEndian.PutUint32(b[0:], uint32(10+len(body)))
+	binary.LittleEndian.PutUint32(b[4:], uint32(id))
+	binary.LittleEndian.PutUint32(b[8:], uint32(packetType))
+	copy(b[12:], body)
+	w.Write(b)
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		repeat   int // Repetitions of the command in its response
+		wantErr  error
+	}{
+		{name: "single packet", password: "secret", repeat: 1},
+		{name: "empty response", password: "secret", repeat: 0},
+		{name: "split response", password: "secret", repeat: 3000},
+		{name: "exact packet length", password: "secret", repeat: maxResponseBodyLength / 4},
+		{name: "wrong password", password: "wrong", wantErr: ErrAuthFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFakeServer(t, "secret", tt.repeat)
+			c, err := Dial(fs.l.Addr().String(), tt.password, 5*time.Second)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Dial error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer c.Close()
+
+			for _, command := range []string{"list", "time"} { // Reuses the connection
+				got, err := c.Command(command)
+				if want := strings.Repeat(command, tt.repeat); err != nil || got != want {
+					t.Errorf("Command(%q) = %d bytes, %v; want %d bytes, nil", command, len(got), err, len(want))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snugfox/mcl/internal/chat"
+)
+
+const (
+	// Port on which Minecraft: Bedrock Edition servers listen by default
+	DefaultBedrockPort int = 19132
+
+	// Interval at which unconnected pings are resent until a pong is received,
+	// as they are sent over UDP
+	bedrockResendInterval time.Duration = time.Second
+
+	// Maximum length of a datagram read from servers
+	maxDatagramLength int = 1500
+)
+
+// Packet IDs of the RakNet unconnected ping and pong
+const (
+	packetUnconnectedPing byte = 0x01
+	packetUnconnectedPong byte = 0x1c
+)
+
+// rakNetMagic is the magic sequence included in offline RakNet messages.
+var rakNetMagic = []byte{
+	0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe,
+	0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78,
+}
+
+// PingBedrock pings a Minecraft: Bedrock Edition server at an address (e.g.
+// localhost:19132) using a RakNet unconnected ping. If the address has no port,
+// the default port is used. As the ping is sent over UDP, it is resent every
+// second until the server responds or the context is done, so the context
+// should have a deadline.
+func PingBedrock(ctx context.Context, address string) (*Status, error) {
+	host, port, _, err := splitAddress(address, DefaultBedrockPort)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// The time field of each ping is its sequence number, which the server
+	// echoes in its pong so that the latency is that of the ping answered
+	var guid uint64
+	if err := binary.Read(rand.Reader, binary.BigEndian, &guid); err != nil {
+		return nil, err
+	}
+	var sent []time.Time
+	b := make([]byte, maxDatagramLength)
+	for {
+		var ping bytes.Buffer
+		ping.WriteByte(packetUnconnectedPing)
+		binary.Write(&ping, binary.BigEndian, int64(len(sent)))
+		ping.Write(rakNetMagic)
+		binary.Write(&ping, binary.BigEndian, guid)
+		sent = append(sent, time.Now())
+		if _, err := conn.Write(ping.Bytes()); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(bedrockResendInterval)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(b)
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			seq, motd, err := parseUnconnectedPong(b[:n])
+			if err != nil || seq < 0 || seq >= int64(len(sent)) {
+				continue // Ignore stray datagrams
+			}
+			latency := time.Since(sent[seq])
+
+			status, err := parseBedrockMOTD(motd)
+			if err != nil {
+				return nil, err
+			}
+			status.Latency = latency
+			return status, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if ctxDeadline, ok := ctx.Deadline(); ok && !time.Now().Before(ctxDeadline) {
+			return nil, context.DeadlineExceeded
+		}
+	}
+}
+
+// parseUnconnectedPong parses an unconnected pong, returning the time echoed
+// from the ping and the server's MOTD string.
+func parseUnconnectedPong(b []byte) (int64, string, error) {
+	const headerLength = 1 + 8 + 8 + 16 + 2 // ID, time, server GUID, magic, string length
+	if len(b) < headerLength || b[0] != packetUnconnectedPong {
+		return 0, "", errors.New("invalid unconnected pong")
+	}
+	if !bytes.Equal(b[17:33], rakNetMagic) {
+		return 0, "", errors.New("invalid unconnected pong")
+	}
+	seq := int64(binary.BigEndian.Uint64(b[1:]))
+	length := int(binary.BigEndian.Uint16(b[33:]))
+	if headerLength+length > len(b) {
+		return 0, "", errors.New("invalid unconnected pong")
+	}
+	return seq, string(b[headerLength : headerLength+length]), nil
+}
+
+// parseBedrockMOTD parses the MOTD string of an unconnected pong, which
+// consists of the edition (e.g. MCPE), MOTD, protocol, version, online players,
+// maximum players, server ID, level name, game mode, numeric game mode, IPv4
+// port, and IPv6 port, separated by semicolons. Servers may omit trailing
+// fields after the player counts, and may add fields after those listed.
+func parseBedrockMOTD(motd string) (*Status, error) {
+	fields := strings.Split(motd, ";")
+	if len(fields) < 6 {
+		return nil, errors.New("invalid unconnected pong MOTD")
+	}
+	protocol, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, errors.New("invalid protocol in unconnected pong MOTD")
+	}
+	online, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, errors.New("invalid player count in unconnected pong MOTD")
+	}
+	max, err := strconv.Atoi(fields[5])
+	if err != nil {
+		return nil, errors.New("invalid player count in unconnected pong MOTD")
+	}
+
+	field := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	status := &Status{
+		Version:   field(3),
+		Protocol:  protocol,
+		MOTD:      chat.StripFormatting(field(1)),
+		Players:   Players{Online: online, Max: max},
+		ServerID:  field(6),
+		LevelName: chat.StripFormatting(field(7)),
+		GameMode:  field(8),
+	}
+	status.PortIPv4, _ = strconv.Atoi(field(10)) // Zero if omitted
+	status.PortIPv6, _ = strconv.Atoi(field(11))
+	return status, nil
+}
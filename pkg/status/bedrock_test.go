@@ -0,0 +1,173 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testBedrockMOTD = "MCPE;§aDedicated§r Server;422;1.16.201;2;10;13253860892328930865;Bedrock level;Survival;1;19132;19133;"
+
+// unconnectedPong returns an unconnected pong echoing a ping time with a MOTD
+// string.
+func unconnectedPong(seq int64, motd string) []byte {
+	var b bytes.Buffer
+	b.WriteByte(packetUnconnectedPong)
+	binary.Write(&b, binary.BigEndian, seq)
+	binary.Write(&b, binary.BigEndian, uint64(1)) // Server GUID
+	b.Write(rakNetMagic)
+	binary.Write(&b, binary.BigEndian, uint16(len(motd)))
+	b.WriteString(motd)
+	return b.Bytes()
+}
+
+func TestParseUnconnectedPong(t *testing.T) {
+	valid := unconnectedPong(3, "MOTD")
+	badMagic := unconnectedPong(3, "MOTD")
+	badMagic[20] ^= 0xff
+	badID := unconnectedPong(3, "MOTD")
+	badID[0] = packetUnconnectedPing
+
+	tests := []struct {
+		name     string
+		b        []byte
+		wantSeq  int64
+		wantMOTD string
+		wantErr  bool
+	}{
+		{name: "valid", b: valid, wantSeq: 3, wantMOTD: "MOTD"},
+		{name: "empty MOTD", b: unconnectedPong(0, ""), wantSeq: 0, wantMOTD: ""},
+		{name: "trailing data", b: append(unconnectedPong(1, "MOTD"), 0, 0), wantSeq: 1, wantMOTD: "MOTD"},
+		{name: "truncated MOTD", b: valid[:len(valid)-1], wantErr: true},
+		{name: "truncated header", b: valid[:20], wantErr: true},
+		{name: "invalid magic", b: badMagic, wantErr: true},
+		{name: "invalid packet ID", b: badID, wantErr: true},
+		{name: "empty", b: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq, motd, err := parseUnconnectedPong(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUnconnectedPong error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (seq != tt.wantSeq || motd != tt.wantMOTD) {
+				t.Errorf("parseUnconnectedPong = %d, %q; want %d, %q", seq, motd, tt.wantSeq, tt.wantMOTD)
+			}
+		})
+	}
+}
+
+func TestParseBedrockMOTD(t *testing.T) {
+	tests := []struct {
+		name    string
+		motd    string
+		want    *Status
+		wantErr bool
+	}{
+		{
+			name: "all fields",
+			motd: testBedrockMOTD,
+			want: &Status{
+				Version:   "1.16.201",
+				Protocol:  422,
+				MOTD:      "Dedicated Server",
+				Players:   Players{Online: 2, Max: 10},
+				ServerID:  "13253860892328930865",
+				LevelName: "Bedrock level",
+				GameMode:  "Survival",
+				PortIPv4:  19132,
+				PortIPv6:  19133,
+			},
+		},
+		{
+			name: "trailing fields omitted",
+			motd: "MCPE;Server;422;1.16.201;0;10",
+			want: &Status{
+				Version:  "1.16.201",
+				Protocol: 422,
+				MOTD:     "Server",
+				Players:  Players{Online: 0, Max: 10},
+			},
+		},
+		{name: "missing player counts", motd: "MCPE;Server;422;1.16.201;0", wantErr: true},
+		{name: "invalid protocol", motd: "MCPE;Server;x;1.16.201;0;10", wantErr: true},
+		{name: "invalid player count", motd: "MCPE;Server;422;1.16.201;0;x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBedrockMOTD(tt.motd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBedrockMOTD error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBedrockMOTD = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// serveBedrockPongs responds to unconnected pings on a UDP connection with
+// pongs, ignoring the first dropped pings as if lost, or all pings if dropped
+// is negative. Each pong is preceded by a stray datagram, which clients should
+// ignore.
+func serveBedrockPongs(conn net.PacketConn, dropped int) {
+	b := make([]byte, maxDatagramLength)
+	for {
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		if n < 9 || b[0] != packetUnconnectedPing {
+			continue
+		}
+		if dropped != 0 {
+			if dropped > 0 {
+				dropped--
+			}
+			continue
+		}
+		seq := int64(binary.BigEndian.Uint64(b[1:]))
+		conn.WriteTo([]byte("stray"), addr)
+		conn.WriteTo(unconnectedPong(seq, testBedrockMOTD), addr)
+	}
+}
+
+func TestPingBedrock(t *testing.T) {
+	tests := []struct {
+		name    string
+		dropped int // Pings dropped by the server, or -1 for all
+		timeout time.Duration
+		wantErr error
+	}{
+		{name: "immediate pong", dropped: 0, timeout: 5 * time.Second},
+		{name: "resent ping", dropped: 1, timeout: 5 * time.Second},
+		{name: "no pong", dropped: -1, timeout: 200 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			go serveBedrockPongs(conn, tt.dropped)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			status, err := PingBedrock(ctx, conn.LocalAddr().String())
+			if err != tt.wantErr {
+				t.Fatalf("PingBedrock error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if status.MOTD != "Dedicated Server" || status.Players.Online != 2 || status.Latency <= 0 {
+				t.Errorf("PingBedrock = %+v", status)
+			}
+		})
+	}
+}
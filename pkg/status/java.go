@@ -0,0 +1,264 @@
+package status
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snugfox/mcl/internal/chat"
+)
+
+const (
+	// Port on which Minecraft: Java Edition servers listen by default
+	DefaultJavaPort int = 25565
+
+	// Protocol version sent in the handshake, which indicates that the client
+	// does not know the server's protocol version
+	handshakeProtocol int32 = -1
+
+	// Maximum length of a packet read from servers
+	maxPacketLength int32 = 1 << 21
+)
+
+// Packet IDs of the status protocol
+const (
+	packetHandshake      int32 = 0x00
+	packetStatusRequest  int32 = 0x00
+	packetStatusResponse int32 = 0x00
+	packetPing           int32 = 0x01
+	packetPong           int32 = 0x01
+)
+
+// Next state requested by the handshake
+const handshakeStateStatus int32 = 1
+
+// javaStatusResponse is the JSON response to a status request.
+type javaStatusResponse struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+		Sample []struct {
+			Name string `json:"name"`
+		} `json:"sample"`
+	} `json:"players"`
+	Description chatComponent `json:"description"`
+}
+
+// chatComponent is a JSON text component, which is either a string or an
+// object with text and extra components.
+type chatComponent struct {
+	Text  string          `json:"text"`
+	Extra []chatComponent `json:"extra"`
+}
+
+func (cc *chatComponent) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		cc.Text = s
+		return nil
+	}
+	type component chatComponent // Avoids recursion
+	return json.Unmarshal(b, (*component)(cc))
+}
+
+// String returns the plain text of the component and its extra components.
+func (cc chatComponent) String() string {
+	var sb strings.Builder
+	sb.WriteString(cc.Text)
+	for _, extra := range cc.Extra {
+		sb.WriteString(extra.String())
+	}
+	return sb.String()
+}
+
+// PingJava pings a Minecraft: Java Edition server at an address (e.g.
+// localhost:25565) using the Server List Ping protocol of Minecraft 1.7 and
+// later. If the address has no port, the port is resolved from the
+// _minecraft._tcp SRV record of the host, as Minecraft clients do, or is
+// otherwise the default port. The latency is measured by a ping following the
+// status request. The context's deadline, if any, applies to the entire ping.
+func PingJava(ctx context.Context, address string) (*Status, error) {
+	conn, host, port, err := dialJava(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	setDeadline(ctx, conn)
+	r := bufio.NewReader(conn)
+
+	// Handshake, and request the status
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, handshakeProtocol)
+	writeString(&handshake, host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	writeVarInt(&handshake, handshakeStateStatus)
+	if err := writePacket(conn, packetHandshake, handshake.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := writePacket(conn, packetStatusRequest, nil); err != nil {
+		return nil, err
+	}
+	id, payload, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != packetStatusResponse {
+		return nil, fmt.Errorf("unexpected packet ID %#x in response to status request", id)
+	}
+	statusJSON, err := readString(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	var resp javaStatusResponse
+	if err := json.Unmarshal([]byte(statusJSON), &resp); err != nil {
+		return nil, err
+	}
+
+	// Measure the latency with a ping
+	start := time.Now()
+	var ping bytes.Buffer
+	binary.Write(&ping, binary.BigEndian, start.UnixNano())
+	if err := writePacket(conn, packetPing, ping.Bytes()); err != nil {
+		return nil, err
+	}
+	if id, payload, err = readPacket(r); err != nil {
+		return nil, err
+	}
+	if id != packetPong || !bytes.Equal(payload, ping.Bytes()) {
+		return nil, errors.New("unexpected response to ping")
+	}
+	latency := time.Since(start)
+
+	status := &Status{
+		Version:  resp.Version.Name,
+		Protocol: resp.Version.Protocol,
+		MOTD:     chat.StripFormatting(resp.Description.String()),
+		Players: Players{
+			Online: resp.Players.Online,
+			Max:    resp.Players.Max,
+		},
+		Latency: latency,
+	}
+	for _, player := range resp.Players.Sample {
+		status.Players.Sample = append(status.Players.Sample, player.Name)
+	}
+	return status, nil
+}
+
+// dialJava connects to a Minecraft: Java Edition server at an address,
+// resolving its port as PingJava does. It returns the host and port to which
+// the client connected as specified by the address or SRV record.
+func dialJava(ctx context.Context, address string) (conn net.Conn, host string, port int, err error) {
+	host, port, ok, err := splitAddress(address, DefaultJavaPort)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if !ok && net.ParseIP(host) == nil {
+		if _, addrs, err := net.DefaultResolver.LookupSRV(ctx, "minecraft", "tcp", host); err == nil && len(addrs) > 0 {
+			host, port = strings.TrimSuffix(addrs[0].Target, "."), int(addrs[0].Port)
+		}
+	}
+
+	var d net.Dialer
+	conn, err = d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, "", 0, err
+	}
+	return conn, host, port, nil
+}
+
+// writePacket writes a packet, prefixed by its length, to a writer.
+func writePacket(w io.Writer, id int32, payload []byte) error {
+	var body bytes.Buffer
+	writeVarInt(&body, id)
+	body.Write(payload)
+
+	var packet bytes.Buffer
+	writeVarInt(&packet, int32(body.Len()))
+	body.WriteTo(&packet)
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// readPacket reads a packet from a reader, returning its ID and payload.
+func readPacket(r *bufio.Reader) (int32, []byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length < 1 || length > maxPacketLength {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+
+	br := bytes.NewReader(b)
+	id, err := readVarInt(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, b[len(b)-br.Len():], nil
+}
+
+// writeVarInt writes a variable-length integer, as encoded by the Minecraft
+// protocol, to a buffer.
+func writeVarInt(buf *bytes.Buffer, v int32) {
+	u := uint32(v)
+	for u >= 0x80 {
+		buf.WriteByte(byte(u) | 0x80)
+		u >>= 7
+	}
+	buf.WriteByte(byte(u))
+}
+
+// readVarInt reads a variable-length integer, as encoded by the Minecraft
+// protocol, from a reader.
+func readVarInt(r io.ByteReader) (int32, error) {
+	var u uint32
+	for i := uint(0); i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		u |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(u), nil
+		}
+	}
+	return 0, errors.New("VarInt is too long")
+}
+
+// writeString writes a string, prefixed by its length in bytes, to a buffer.
+func writeString(buf *bytes.Buffer, s string) {
+	writeVarInt(buf, int32(len(s)))
+	buf.WriteString(s)
+}
+
+// readString reads a string, prefixed by its length in bytes, from a reader.
+func readString(r *bytes.Reader) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || int(length) > r.Len() {
+		return "", fmt.Errorf("invalid string length %d", length)
+	}
+	b := make([]byte, length)
+	r.Read(b)
+	return string(b), nil
+}
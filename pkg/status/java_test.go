@@ -0,0 +1,57 @@
+package status
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestVarInt(t *testing.T) {
+	tests := []struct {
+		v       int32
+		encoded string // Hex-encoded
+	}{
+		{0, "00"},
+		{1, "01"},
+		{127, "7f"},
+		{128, "8001"},
+		{255, "ff01"},
+		{25565, "ddc701"},
+		{2097151, "ffff7f"},
+		{2147483647, "ffffffff07"},
+		{-1, "ffffffff0f"},
+		{-2147483648, "8080808008"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeVarInt(&buf, tt.v)
+		if got := hex.EncodeToString(buf.Bytes()); got != tt.encoded {
+			t.Errorf("writeVarInt(%d) = %s, want %s", tt.v, got, tt.encoded)
+		}
+
+		b, _ := hex.DecodeString(tt.encoded)
+		if got, err := readVarInt(bytes.NewReader(b)); err != nil || got != tt.v {
+			t.Errorf("readVarInt(%s) = %d, %v; want %d, nil", tt.encoded, got, err, tt.v)
+		}
+	}
+}
+
+func TestReadVarIntInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string // Hex-encoded
+		wantEOF bool
+	}{
+		{name: "empty", encoded: "", wantEOF: true},
+		{name: "truncated", encoded: "ff", wantEOF: true},
+		{name: "too long", encoded: "ffffffffff01"},
+	}
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.encoded)
+		_, err := readVarInt(bytes.NewReader(b))
+		if err == nil || (err == io.EOF) != tt.wantEOF {
+			t.Errorf("readVarInt(%s) error = %v, want EOF %v", tt.name, err, tt.wantEOF)
+		}
+	}
+}
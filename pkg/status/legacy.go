@@ -0,0 +1,154 @@
+package status
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/snugfox/mcl/internal/chat"
+)
+
+const (
+	// Packet IDs of the legacy ping, and the channel of the plugin message that
+	// follows it
+	packetLegacyPing      byte   = 0xfe
+	packetPluginMessage   byte   = 0xfa
+	packetKick            byte   = 0xff
+	legacyPingChannel     string = "MC|PingHost"
+	legacyPingPayloadByte byte   = 0x01
+
+	// Protocol version sent in the legacy ping, which is that of Minecraft
+	// 1.6.4
+	legacyProtocol byte = 74
+
+	// Prefix of the kick message of servers supporting the 1.6 format
+	legacyResponsePrefix string = "§1\x00"
+)
+
+// PingJavaLegacy pings a Minecraft: Java Edition server at an address (e.g.
+// localhost:25565) using the legacy Server List Ping protocol of Minecraft 1.6,
+// for servers prior to Minecraft 1.7. Servers prior to Minecraft 1.4 only
+// report the MOTD and player counts. The address is resolved as PingJava does,
+// and the latency is the round-trip time of the ping itself.
+func PingJavaLegacy(ctx context.Context, address string) (*Status, error) {
+	conn, host, port, err := dialJava(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	setDeadline(ctx, conn)
+
+	// Ping, followed by a plugin message with the host and port as Minecraft
+	// 1.6 clients do
+	var data bytes.Buffer
+	data.WriteByte(legacyProtocol)
+	writeLegacyString(&data, host)
+	binary.Write(&data, binary.BigEndian, int32(port))
+
+	var ping bytes.Buffer
+	ping.WriteByte(packetLegacyPing)
+	ping.WriteByte(legacyPingPayloadByte)
+	ping.WriteByte(packetPluginMessage)
+	writeLegacyString(&ping, legacyPingChannel)
+	binary.Write(&ping, binary.BigEndian, int16(data.Len()))
+	data.WriteTo(&ping)
+
+	start := time.Now()
+	if _, err := conn.Write(ping.Bytes()); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	id, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if id != packetKick {
+		return nil, errors.New("unexpected response to legacy ping")
+	}
+	resp, err := readLegacyString(r)
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+
+	status, err := parseLegacyResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	status.Latency = latency
+	return status, nil
+}
+
+// parseLegacyResponse parses the kick message in response to a legacy ping,
+// which is either in the format of Minecraft 1.4 and later (§1, protocol,
+// version, MOTD, online players, and maximum players, separated by NUL
+// characters) or in that of earlier versions (MOTD, online players, and maximum
+// players, separated by §).
+func parseLegacyResponse(resp string) (*Status, error) {
+	var fields []string
+	status := new(Status)
+	if strings.HasPrefix(resp, legacyResponsePrefix) {
+		fields = strings.Split(strings.TrimPrefix(resp, legacyResponsePrefix), "\x00")
+		if len(fields) != 5 {
+			return nil, errors.New("invalid legacy ping response")
+		}
+		protocol, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, errors.New("invalid protocol in legacy ping response")
+		}
+		status.Protocol = protocol
+		status.Version = fields[1]
+		fields = fields[2:]
+	} else {
+		fields = strings.Split(resp, "§")
+		if len(fields) < 3 {
+			return nil, errors.New("invalid legacy ping response")
+		}
+		// The MOTD may itself contain §, as long as the player counts follow
+		fields = append([]string{strings.Join(fields[:len(fields)-2], "§")}, fields[len(fields)-2:]...)
+	}
+
+	online, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, errors.New("invalid player count in legacy ping response")
+	}
+	max, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, errors.New("invalid player count in legacy ping response")
+	}
+	status.MOTD = chat.StripFormatting(fields[0])
+	status.Players = Players{Online: online, Max: max}
+	return status, nil
+}
+
+// writeLegacyString writes a UTF-16BE string, prefixed by its length in code
+// units, to a buffer.
+func writeLegacyString(buf *bytes.Buffer, s string) {
+	u := utf16.Encode([]rune(s))
+	binary.Write(buf, binary.BigEndian, int16(len(u)))
+	binary.Write(buf, binary.BigEndian, u)
+}
+
+// readLegacyString reads a UTF-16BE string, prefixed by its length in code
+// units, from a reader.
+func readLegacyString(r io.Reader) (string, error) {
+	var length int16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length < 0 {
+		return "", errors.New("invalid string length")
+	}
+	u := make([]uint16, length)
+	if err := binary.Read(r, binary.BigEndian, u); err != nil {
+		return "", err
+	}
+	return string(utf16.Decode(u)), nil
+}
@@ -0,0 +1,53 @@
+package status
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLegacyResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    string
+		want    *Status
+		wantErr bool
+	}{
+		{
+			name: "1.4 format",
+			resp: "§1\x0074\x001.6.4\x00A §aMinecraft§r Server\x003\x0020",
+			want: &Status{
+				Version:  "1.6.4",
+				Protocol: 74,
+				MOTD:     "A Minecraft Server",
+				Players:  Players{Online: 3, Max: 20},
+			},
+		},
+		{
+			name: "pre-1.4 format",
+			resp: "A Minecraft Server§3§20",
+			want: &Status{MOTD: "A Minecraft Server", Players: Players{Online: 3, Max: 20}},
+		},
+		{
+			name: "pre-1.4 format with formatted MOTD",
+			resp: "§aGreen§r Server§0§10",
+			want: &Status{MOTD: "Green Server", Players: Players{Online: 0, Max: 10}},
+		},
+		{name: "1.4 format missing fields", resp: "§1\x0074\x001.6.4\x00MOTD\x003", wantErr: true},
+		{name: "1.4 format invalid protocol", resp: "§1\x00x\x001.6.4\x00MOTD\x003\x0020", wantErr: true},
+		{name: "1.4 format invalid player count", resp: "§1\x0074\x001.6.4\x00MOTD\x00x\x0020", wantErr: true},
+		{name: "pre-1.4 format missing fields", resp: "MOTD§3", wantErr: true},
+		{name: "pre-1.4 format invalid player count", resp: "MOTD§3§x", wantErr: true},
+		{name: "empty", resp: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLegacyResponse(tt.resp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLegacyResponse error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLegacyResponse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package status
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the status of a server as reported by a ping.
+type Status struct {
+	// Version is the name of the server version (e.g. 1.16.5 or Paper 1.16.5),
+	// and Protocol is its protocol version number.
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+
+	// MOTD is the message of the day as plain text, without formatting.
+	MOTD string `json:"motd"`
+
+	// Players contains the player counts, and may list a sample of the players
+	// online.
+	Players Players `json:"players"`
+
+	// Latency is the round-trip time of the ping.
+	Latency time.Duration `json:"-"`
+
+	// Fields below are only reported by Minecraft: Bedrock Edition servers.
+
+	// ServerID is the unique ID of the server, LevelName is the name of its
+	// world, and GameMode is its default game mode (e.g. Survival).
+	ServerID  string `json:"serverId,omitempty"`
+	LevelName string `json:"levelName,omitempty"`
+	GameMode  string `json:"gameMode,omitempty"`
+
+	// PortIPv4 and PortIPv6 are the ports on which the server listens for IPv4
+	// and IPv6 clients, respectively.
+	PortIPv4 int `json:"portIPv4,omitempty"`
+	PortIPv6 int `json:"portIPv6,omitempty"`
+}
+
+// Players contains the player counts of a server.
+type Players struct {
+	Online int      `json:"online"`
+	Max    int      `json:"max"`
+	Sample []string `json:"sample,omitempty"`
+}
+
+// splitAddress splits an address into its host and port, using a default port
+// if the address has none. It returns whether the port was specified.
+func splitAddress(address string, defaultPort int) (host string, port int, ok bool, err error) {
+	h, p, err := net.SplitHostPort(address)
+	if err != nil {
+		// The address has no port if it is a hostname or IP address alone
+		host = strings.Trim(address, "[]")
+		if net.ParseIP(host) == nil && strings.Contains(address, ":") {
+			return "", 0, false, err
+		}
+		return host, defaultPort, false, nil
+	}
+	if port, err = strconv.Atoi(p); err != nil || port < 0 || port > 65535 {
+		return "", 0, false, &net.AddrError{Err: "invalid port", Addr: address}
+	}
+	return h, port, true, nil
+}
+
+// setDeadline sets the deadline of a connection to that of a context, if any.
+func setDeadline(ctx context.Context, conn net.Conn) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Name of the blob directory within a store directory
+const blobDirName string = ".blobs"
+
+// Checksum algorithms by which blobs are keyed
+const (
+	SHA1   string = "sha1"
+	SHA256 string = "sha256"
+)
+
+// BlobStore is a content-addressed store of files (blobs) shared by the base
+// directories of a store, such that identical files are stored once. Each blob
+// is keyed by a checksum algorithm and its hex-encoded checksum, and is linked
+// into base directories by a reflink (i.e. copy-on-write clone) where
+// supported, or otherwise by a hard link, falling back to a copy if neither is
+// possible (e.g. across file systems).
+//
+// As hard links share their contents, files linked from a blob store must not
+// be modified in place; they may only be replaced.
+type BlobStore struct {
+	// Dir is the directory containing the blobs.
+	Dir string
+}
+
+// NewBlobStore returns a new blob store within a specified store directory.
+func NewBlobStore(storeDir string) *BlobStore {
+	return &BlobStore{Dir: filepath.Join(storeDir, blobDirName)}
+}
+
+// Path returns the path of the blob for a checksum algorithm and hex-encoded
+// checksum, regardless of whether it exists.
+func (bs *BlobStore) Path(algorithm, sum string) (string, error) {
+	var size int
+	switch algorithm {
+	case SHA1:
+		size = sha1.Size
+	case SHA256:
+		size = sha256.Size
+	default:
+		return "", errors.New("unsupported checksum algorithm " + algorithm)
+	}
+	sum = strings.ToLower(sum)
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != size {
+		return "", errors.New("invalid " + algorithm + " checksum " + sum)
+	}
+	return filepath.Join(bs.Dir, algorithm, sum[:2], sum), nil
+}
+
+// Link links the blob for a checksum algorithm and hex-encoded checksum to a
+// path, replacing any existing file. It returns false and a nil error if the
+// blob does not exist.
+func (bs *BlobStore) Link(algorithm, sum, path string) (bool, error) {
+	blobPath, err := bs.Path(algorithm, sum)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(blobPath); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, linkFile(blobPath, path)
+}
+
+// Lock acquires an exclusive advisory lock on the blob for a checksum algorithm
+// and hex-encoded checksum, waiting until it is acquired or the context is done.
+// Processes should hold the lock while writing the blob so that concurrent
+// processes sharing the blob store do not write the same blob. The lock is
+// shared by the blobs whose checksums begin with the same byte.
+func (bs *BlobStore) Lock(ctx context.Context, algorithm, sum string) (*Lock, error) {
+	blobPath, err := bs.Path(algorithm, sum)
+	if err != nil {
+		return nil, err
+	}
+	return LockBaseDir(ctx, filepath.Dir(blobPath), 0, nil)
+}
+
+// Add adds the file at a path to the blob store, keyed by its SHA-256
+// checksum, and replaces the file with a link to the blob if an identical blob
+// already exists. Otherwise, the blob is linked from the file. Existing blobs
+// are verified first, as blobs shared through hard links may have been
+// modified in place, and are replaced by the file if they fail verification.
+func (bs *BlobStore) Add(path string) error {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	blobPath, err := bs.Path(SHA256, sum)
+	if err != nil {
+		return err
+	}
+
+	blobInfo, err := os.Stat(blobPath)
+	if os.IsNotExist(err) {
+		return linkFile(path, blobPath)
+	} else if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(fi, blobInfo) {
+		return nil // Already linked
+	}
+	if blobSum, err := fileSHA256(blobPath); err != nil {
+		return err
+	} else if blobSum != sum {
+		return linkFile(path, blobPath)
+	}
+	return linkFile(blobPath, path)
+}
+
+// AddDir adds each regular file within a directory and its subdirectories to
+// the blob store as Add does.
+func (bs *BlobStore) AddDir(dir string) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		return bs.Add(path)
+	})
+}
+
+// Functions by which linkFile attempts to link files before falling back to a
+// copy, which are replaced by tests
+var (
+	reflinkFile = reflink
+	hardLink    = os.Link
+)
+
+// linkFile links a file to a destination path, replacing any existing file. It
+// creates a reflink if supported, or otherwise a hard link, falling back to a
+// copy. The destination is only replaced once linked, and any parent
+// directories are created. The link is created within a unique temporary
+// directory, so concurrent links to the same destination do not collide.
+func linkFile(src, dst string) error {
+	dir, filename := filepath.Split(dst)
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, os.ModeDir|0755); err != nil {
+		return err
+	}
+	tmpDir, err := ioutil.TempDir(dir, "."+filename+".link")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpPath := filepath.Join(tmpDir, filename)
+
+	if err := reflinkFile(src, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		if err := hardLink(src, tmpPath); err != nil {
+			if err := copyFile(src, tmpPath); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+// copyFile copies the contents and permissions of a file to a new file.
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	fi, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
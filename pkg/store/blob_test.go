@@ -0,0 +1,283 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newBlobStore returns a blob store within a new temporary store directory,
+// along with the store directory.
+func newBlobStore(t *testing.T) (*BlobStore, string) {
+	t.Helper()
+	storeDir := makeStore(t, "", nil, nil)
+	return NewBlobStore(storeDir), storeDir
+}
+
+// writeFile writes a file with contents, creating any parent directories.
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkContents checks that a file has the expected contents.
+func checkContents(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s contains %q, want %q", filepath.Base(path), got, want)
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// setLinkFuncs replaces the functions by which linkFile links files for the
+// duration of a test. Nil functions always fail.
+func setLinkFuncs(t *testing.T, reflinkFn, hardLinkFn func(string, string) error) {
+	prevReflink, prevHardLink := reflinkFile, hardLink
+	fail := func(_, dst string) error {
+		return &os.LinkError{Op: "link", New: dst, Err: errors.New("not supported")}
+	}
+	if reflinkFn == nil {
+		reflinkFn = fail
+	}
+	if hardLinkFn == nil {
+		hardLinkFn = fail
+	}
+	reflinkFile, hardLink = reflinkFn, hardLinkFn
+	t.Cleanup(func() {
+		reflinkFile, hardLink = prevReflink, prevHardLink
+	})
+}
+
+func TestBlobStorePath(t *testing.T) {
+	bs := &BlobStore{Dir: "blobs"}
+	sha1Sum := strings.Repeat("ab", 20)
+	sha256Sum := strings.Repeat("cd", 32)
+	tests := []struct {
+		algorithm string
+		sum       string
+		want      string
+		wantErr   bool
+	}{
+		{algorithm: SHA1, sum: sha1Sum, want: filepath.Join("blobs", "sha1", "ab", sha1Sum)},
+		{algorithm: SHA256, sum: strings.ToUpper(sha256Sum), want: filepath.Join("blobs", "sha256", "cd", sha256Sum)},
+		{algorithm: SHA256, sum: sha1Sum, wantErr: true},
+		{algorithm: SHA1, sum: "../" + sha1Sum[3:], wantErr: true},
+		{algorithm: "md5", sum: strings.Repeat("ef", 16), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := bs.Path(tt.algorithm, tt.sum)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Path(%q, %q) error = %v, wantErr %v", tt.algorithm, tt.sum, err, tt.wantErr)
+		} else if got != tt.want {
+			t.Errorf("Path(%q, %q) = %q, want %q", tt.algorithm, tt.sum, got, tt.want)
+		}
+	}
+}
+
+func TestLinkFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		hardLinkFn func(string, string) error
+		wantSame   bool // Whether the link shares the file of the source
+	}{
+		{name: "hard link", hardLinkFn: os.Link, wantSame: true},
+		{name: "copy", hardLinkFn: nil, wantSame: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLinkFuncs(t, nil, tt.hardLinkFn)
+			dir := makeStore(t, "", nil, nil)
+			src := filepath.Join(dir, "src")
+			dst := filepath.Join(dir, "nested", "dst")
+			writeFile(t, src, "contents")
+			writeFile(t, dst, "replaced")
+
+			if err := linkFile(src, dst); err != nil {
+				t.Fatalf("linkFile error = %v", err)
+			}
+			checkContents(t, dst, "contents")
+			srcInfo, err := os.Stat(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dstInfo, err := os.Stat(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := os.SameFile(srcInfo, dstInfo); same != tt.wantSame {
+				t.Errorf("linked file is same as source = %t, want %t", same, tt.wantSame)
+			}
+			if runtime.GOOS != "windows" && dstInfo.Mode().Perm() != srcInfo.Mode().Perm() {
+				t.Errorf("linked file mode = %v, want %v", dstInfo.Mode().Perm(), srcInfo.Mode().Perm())
+			}
+
+			// No temporary files are left behind
+			infos, err := ioutil.ReadDir(filepath.Dir(dst))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(infos) != 1 {
+				t.Errorf("directory contains %d files after link, want 1", len(infos))
+			}
+		})
+	}
+}
+
+func TestBlobStoreLink(t *testing.T) {
+	bs, storeDir := newBlobStore(t)
+	sum := sha256Hex("contents")
+	path := filepath.Join(storeDir, "java", "1.16.5", "server.jar")
+
+	if ok, err := bs.Link(SHA256, sum, path); ok || err != nil {
+		t.Errorf("Link of missing blob = %t, %v; want false, nil", ok, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file exists after link of missing blob: %v", err)
+	}
+
+	blobPath, err := bs.Path(SHA256, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, blobPath, "contents")
+	if ok, err := bs.Link(SHA256, sum, path); !ok || err != nil {
+		t.Fatalf("Link = %t, %v; want true, nil", ok, err)
+	}
+	checkContents(t, path, "contents")
+}
+
+func TestBlobStoreAdd(t *testing.T) {
+	setLinkFuncs(t, nil, os.Link)
+	bs, storeDir := newBlobStore(t)
+	first := filepath.Join(storeDir, "java", "1.16.4", "libraries", "lib.jar")
+	second := filepath.Join(storeDir, "java", "1.16.5", "libraries", "lib.jar")
+	writeFile(t, first, "library")
+	writeFile(t, second, "library")
+	blobPath, err := bs.Path(SHA256, sha256Hex("library"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Identical files share a blob
+	for _, path := range []string{first, second} {
+		if err := bs.Add(path); err != nil {
+			t.Fatalf("Add error = %v", err)
+		}
+	}
+	checkContents(t, blobPath, "library")
+	checkSameFile(t, first, blobPath)
+	checkSameFile(t, second, blobPath)
+
+	// Files are not replaced by corrupted blobs, which are instead replaced by
+	// the file
+	if err := ioutil.WriteFile(blobPath, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	third := filepath.Join(storeDir, "java", "1.16.3", "libraries", "lib.jar")
+	writeFile(t, third, "library")
+	if err := bs.Add(third); err != nil {
+		t.Fatalf("Add error = %v", err)
+	}
+	checkContents(t, third, "library")
+	checkContents(t, blobPath, "library")
+	checkSameFile(t, third, blobPath)
+}
+
+// checkSameFile checks that two paths are links to the same file.
+func checkSameFile(t *testing.T, path1, path2 string) {
+	t.Helper()
+	fi1, err := os.Stat(path1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := os.Stat(path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(fi1, fi2) {
+		t.Errorf("%s and %s are not the same file", path1, path2)
+	}
+}
+
+func TestBlobStoreAddDir(t *testing.T) {
+	bs, storeDir := newBlobStore(t)
+	dir := filepath.Join(storeDir, "java", "1.16.5", "libraries")
+	files := map[string]string{
+		"a.jar":          "a",
+		"nested/b.jar":   "b",
+		"nested/c/c.jar": "c",
+	}
+	for name, contents := range files {
+		writeFile(t, filepath.Join(dir, filepath.FromSlash(name)), contents)
+	}
+
+	if err := bs.AddDir(dir); err != nil {
+		t.Fatalf("AddDir error = %v", err)
+	}
+	for name, contents := range files {
+		blobPath, err := bs.Path(SHA256, sha256Hex(contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkContents(t, blobPath, contents)
+		checkContents(t, filepath.Join(dir, filepath.FromSlash(name)), contents)
+	}
+
+	if err := bs.AddDir(filepath.Join(storeDir, "missing")); err == nil {
+		t.Error("AddDir of missing directory succeeded")
+	}
+}
+
+func TestBlobStoreLock(t *testing.T) {
+	bs, _ := newBlobStore(t)
+	sum := "ab" + strings.Repeat("0", 62)
+	sameShard := "ab" + strings.Repeat("1", 62)
+	otherShard := "cd" + strings.Repeat("0", 62)
+
+	lock, err := bs.Lock(context.Background(), SHA256, sum)
+	if err != nil {
+		t.Fatalf("Lock error = %v", err)
+	}
+	defer lock.Unlock()
+
+	// Blobs in the same shard share the lock
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if l, err := bs.Lock(ctx, SHA256, sameShard); err != context.DeadlineExceeded {
+		if err == nil {
+			l.Unlock()
+		}
+		t.Errorf("Lock of same shard error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	otherLock, err := bs.Lock(context.Background(), SHA256, otherShard)
+	if err != nil {
+		t.Fatalf("Lock of other shard error = %v", err)
+	}
+	otherLock.Unlock()
+
+	if _, err := bs.Lock(context.Background(), SHA256, "invalid"); err == nil {
+		t.Error("Lock of invalid checksum succeeded")
+	}
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Filename of the lock file created in a base directory
+const lockFilename string = ".mcl-lock"
+
+// Interval between attempts to acquire a lock held by another process
+const lockPollInterval time.Duration = 250 * time.Millisecond
+
+// ErrLockTimeout is returned when a lock could not be acquired within the wait
+// timeout.
+var ErrLockTimeout = errors.New("timed out waiting for lock")
+
+// errLocked is returned by tryLock when the lock is held by another process.
+var errLocked = errors.New("locked by another process")
+
+// Lock is an advisory lock on a base directory or blob, which is held across
+// processes for as long as the process holding it is alive.
+type Lock struct {
+	f *os.File
+}
+
+// LockBaseDir acquires an exclusive advisory lock on a base directory,
+// creating the directory if it does not exist. Processes should hold the lock
+// while fetching or preparing server resources so that concurrent processes
+// sharing the store do not modify the same resources.
+//
+// If the lock is held by another process, wait is called, if non-nil, and the
+// lock is reattempted until it is acquired, the timeout elapses, or the
+// context is done. If the timeout is zero or negative, LockBaseDir waits
+// indefinitely.
+func LockBaseDir(ctx context.Context, baseDir string, timeout time.Duration, wait func()) (*Lock, error) {
+	if err := os.MkdirAll(baseDir, os.ModeDir|0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(baseDir, lockFilename), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	var deadline <-chan time.Time
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for waited := false; ; waited = true {
+		err := tryLock(f)
+		if err == nil {
+			return &Lock{f: f}, nil
+		} else if err != errLocked {
+			f.Close()
+			return nil, err
+		}
+
+		if !waited {
+			if wait != nil {
+				wait()
+			}
+			if timeout > 0 {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				deadline = timer.C
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			f.Close()
+			return nil, ErrLockTimeout
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	return l.f.Close() // Closing the lock file releases the lock
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// Flags for LockFileEx
+	lockfileFailImmediately uintptr = 0x1
+	lockfileExclusiveLock   uintptr = 0x2
+
+	// Error returned by LockFileEx when the lock is held by another process
+	errorLockViolation syscall.Errno = 33
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// tryLock attempts to acquire an exclusive lock on a file without blocking,
+// returning errLocked if it is held by another process.
+func tryLock(f *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(
+		f.Fd(),
+		lockfileExclusiveLock|lockfileFailImmediately,
+		0, // Reserved
+		1, // Lock the first byte
+		0,
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if r != 0 {
+		return nil
+	}
+	if err == errorLockViolation {
+		return errLocked
+	}
+	return &os.PathError{Op: "LockFileEx", Path: f.Name(), Err: err}
+}
@@ -1,7 +1,10 @@
 package store
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"text/template"
 )
@@ -28,3 +31,86 @@ func BaseDir(storeDir, structureTmpl, edition, version string) (string, error) {
 	}
 	return filepath.Join(storeDir, dir.String()), nil
 }
+
+// Name of the BuildTools work directory within a store directory
+const buildToolsDirName string = ".buildtools"
+
+// BuildToolsDir returns the path of the BuildTools work directory within a
+// specified store directory, which is shared by all base directories of the
+// store such that repositories and dependencies are only cached once (see
+// provider.BuildToolsProvider).
+func BuildToolsDir(storeDir string) string {
+	return filepath.Join(storeDir, buildToolsDirName)
+}
+
+// versionPlaceholder stands in for the version when locating the version
+// within paths formed by BaseDir.
+const versionPlaceholder string = "\x00version\x00"
+
+// Versions returns the versions of an edition for which base directories exist
+// within a specified store directory and structure template. The structure
+// template must include the version as a single path element, or a part
+// thereof.
+func Versions(storeDir, structureTmpl, edition string) ([]string, error) {
+	tmplDir, err := BaseDir(storeDir, structureTmpl, edition, versionPlaceholder)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(tmplDir, versionPlaceholder)
+	if len(parts) < 2 {
+		return nil, errors.New("directory structure does not include the version")
+	}
+
+	// Glob for base directories, replacing the version with a wildcard
+	var pattern strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			pattern.WriteByte('*')
+		}
+		pattern.WriteString(escapeGlob(part))
+	}
+	matches, err := filepath.Glob(pattern.String())
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if fi, err := os.Stat(match); err != nil || !fi.IsDir() {
+			continue
+		}
+
+		// Extract the version following the prefix, and verify that it forms the
+		// same base directory in case the version occurs more than once
+		version := strings.TrimPrefix(match, parts[0])
+		if i := strings.Index(version, parts[1]); parts[1] != "" && i >= 0 {
+			version = version[:i]
+		}
+		if version == "" {
+			continue
+		}
+		if baseDir, err := BaseDir(storeDir, structureTmpl, edition, version); err != nil || baseDir != match {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// escapeGlob escapes the special characters of a filepath.Match pattern within
+// a path. Paths are not escaped on Windows, where the escape character is the
+// path separator.
+func escapeGlob(path string) string {
+	if runtime.GOOS == "windows" {
+		return path
+	}
+	var sb strings.Builder
+	for _, c := range path {
+		switch c {
+		case '*', '?', '[', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
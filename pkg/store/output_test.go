@@ -0,0 +1,132 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// makeStore creates a store within a new temporary directory containing
+// directories and empty files, given as slash-separated paths relative to the
+// store, returning the store directory.
+func makeStore(t *testing.T, storeName string, dirs, files []string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "mcl-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	storeDir := filepath.Join(dir, storeName)
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(storeDir, filepath.FromSlash(d)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range files {
+		path := filepath.Join(storeDir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return storeDir
+}
+
+func TestVersions(t *testing.T) {
+	tests := []struct {
+		name      string
+		storeName string // Name of the store directory
+		structure string
+		dirs      []string
+		files     []string
+		want      []string
+		wantErr   bool
+		posixOnly bool // Whether the store name is invalid on Windows
+	}{
+		{
+			name:      "default structure",
+			structure: "{{.Edition}}/{{.Version}}/",
+			dirs:      []string{"java/1.16.4", "java/1.16.5", "paper/1.16.3", ".blobs/sha1"},
+			want:      []string{"1.16.4", "1.16.5"},
+		},
+		{
+			name:      "non-directory matches",
+			structure: "{{.Edition}}/{{.Version}}",
+			dirs:      []string{"java/1.16.5"},
+			files:     []string{"java/1.16.4", "java/.mcl-lock"},
+			want:      []string{"1.16.5"},
+		},
+		{
+			name:      "nested structure",
+			structure: "editions/{{.Edition}}/versions/{{.Version}}/server",
+			dirs:      []string{"editions/java/versions/1.16.4/server", "editions/java/versions/1.16.5/server", "editions/java/versions/1.16.3"},
+			files:     []string{"editions/java/versions/1.16.2/server"},
+			want:      []string{"1.16.4", "1.16.5"},
+		},
+		{
+			name:      "version within path element",
+			structure: "{{.Edition}}-v{{.Version}}-server",
+			dirs:      []string{"java-v1.16.4-server", "java-v1.16.5-server", "java-v1.16.5-client", "paper-v1.16.5-server"},
+			files:     []string{"java-v1.16.3-server"},
+			want:      []string{"1.16.4", "1.16.5"},
+		},
+		{
+			name:      "version within nested path element",
+			structure: "{{.Edition}}/release-{{.Version}}/",
+			dirs:      []string{"java/release-1.16.4", "java/snapshot-20w51a", "java/release-"},
+			want:      []string{"1.16.4"},
+		},
+		{
+			name:      "repeated version",
+			structure: "{{.Version}}/{{.Edition}}-{{.Version}}",
+			dirs:      []string{"1.16.4/java-1.16.4", "1.16.5/java-1.16.5", "1.16.3/java-1.16.5"},
+			want:      []string{"1.16.4", "1.16.5"},
+		},
+		{
+			name:      "no versions",
+			structure: "{{.Edition}}/{{.Version}}",
+			dirs:      []string{"paper/1.16.5"},
+			want:      []string{},
+		},
+		{
+			name:      "structure without version",
+			structure: "{{.Edition}}",
+			dirs:      []string{"java"},
+			wantErr:   true,
+		},
+		{
+			name:      "glob characters in store directory",
+			storeName: "store[*?]",
+			structure: "{{.Edition}}/{{.Version}}",
+			dirs:      []string{"java/1.16.5"},
+			want:      []string{"1.16.5"},
+			posixOnly: true,
+		},
+		{
+			name:      "invalid structure",
+			structure: "{{.Edition}/{{.Version}}",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.posixOnly && runtime.GOOS == "windows" {
+				t.Skip("store name is invalid on Windows")
+			}
+			storeDir := makeStore(t, tt.storeName, tt.dirs, tt.files)
+			got, err := Versions(storeDir, tt.structure, "java")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Versions(%q) error = %v, wantErr %v", tt.structure, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Versions(%q) = %q, want %q", tt.structure, got, tt.want)
+			}
+		})
+	}
+}
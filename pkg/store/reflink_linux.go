@@ -0,0 +1,36 @@
+package store
+
+import (
+	"os"
+	"syscall"
+)
+
+// Request code of the FICLONE ioctl, which clones a file on file systems that
+// support reflinks (e.g. Btrfs and XFS)
+const ficlone uintptr = 0x40049409
+
+// reflink creates a new file that is a reflink of a file.
+func reflink(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	fi, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dstFile.Fd(), ficlone, srcFile.Fd())
+	if closeErr := dstFile.Close(); errno == 0 && closeErr != nil {
+		return closeErr
+	}
+	if errno != 0 {
+		return &os.PathError{Op: "reflink", Path: dst, Err: errno}
+	}
+	return nil
+}
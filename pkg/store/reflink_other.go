@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package store
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink creates a new file that is a reflink of a file. Reflinks are only
+// supported on Linux.
+func reflink(_, dst string) error {
+	return &os.PathError{Op: "reflink", Path: dst, Err: errors.New("not supported")}
+}